@@ -51,4 +51,66 @@ const (
 	BLOCK_BOOKSHELF = 47
 	BLOCK_MOSSY_COBBLESTONE = 48
 	BLOCK_OBSIDIAN = 49
-)
\ No newline at end of file
+
+	// CPE CustomBlocks
+
+	BLOCK_COBBLESTONE_SLAB = 50
+	BLOCK_ROPE = 51
+	BLOCK_SANDSTONE = 52
+	BLOCK_SNOW = 53
+	BLOCK_FIRE = 54
+	BLOCK_LIGHT_PINK_CLOTH = 55
+	BLOCK_FOREST_GREEN_CLOTH = 56
+	BLOCK_BROWN_CLOTH = 57
+	BLOCK_DEEP_BLUE_CLOTH = 58
+	BLOCK_TURQUOISE_CLOTH = 59
+	BLOCK_ICE = 60
+	BLOCK_CERAMIC_TILE = 61
+	BLOCK_MAGMA = 62
+	BLOCK_PILLAR = 63
+	BLOCK_CRATE = 64
+	BLOCK_STONE_BRICK = 65
+)
+
+const (
+	BLOCK_MAX_CLASSIC = BLOCK_OBSIDIAN
+	BLOCK_MAX_CUSTOM_BLOCKS = BLOCK_STONE_BRICK
+	BLOCK_MAX_BYTE = 255 // Highest block ID for clients that do not support ExtendedBlocks
+	BLOCK_MAX_EXTENDED = 767 // Highest block ID with ExtendedBlocks (the protocol allows 10 bits, but clients only support 768 blocks)
+	BLOCK_COUNT = BLOCK_MAX_EXTENDED + 1
+)
+
+// Classic blocks that are shown to clients that do not support CustomBlocks
+
+var CUSTOM_BLOCKS_FALLBACK = map[byte]byte{
+	BLOCK_COBBLESTONE_SLAB: BLOCK_SLAB,
+	BLOCK_ROPE: BLOCK_BROWN_MUSHROOM,
+	BLOCK_SANDSTONE: BLOCK_SAND,
+	BLOCK_SNOW: BLOCK_AIR,
+	BLOCK_FIRE: BLOCK_FLOWING_LAVA,
+	BLOCK_LIGHT_PINK_CLOTH: BLOCK_ROSE_CLOTH,
+	BLOCK_FOREST_GREEN_CLOTH: BLOCK_GREEN_CLOTH,
+	BLOCK_BROWN_CLOTH: BLOCK_DIRT,
+	BLOCK_DEEP_BLUE_CLOTH: BLOCK_ULTRAMARINE_CLOTH,
+	BLOCK_TURQUOISE_CLOTH: BLOCK_CYAN_CLOTH,
+	BLOCK_ICE: BLOCK_GLASS,
+	BLOCK_CERAMIC_TILE: BLOCK_IRON,
+	BLOCK_MAGMA: BLOCK_OBSIDIAN,
+	BLOCK_PILLAR: BLOCK_WHITE_CLOTH,
+	BLOCK_CRATE: BLOCK_PLANKS,
+	BLOCK_STONE_BRICK: BLOCK_STONE,
+}
+
+func Fallback(id uint16) uint16 {
+	if id > BLOCK_MAX_BYTE {
+		return id
+	}
+
+	fallback, exists := CUSTOM_BLOCKS_FALLBACK[byte(id)]
+
+	if exists {
+		return uint16(fallback)
+	}
+
+	return id
+}
\ No newline at end of file
@@ -0,0 +1,223 @@
+package blocks
+
+import (
+	"bytes"
+	"errors"
+	"goserver/serialization"
+)
+
+const (
+	SOLIDITY_WALK_THROUGH = 0
+	SOLIDITY_SWIM_THROUGH = 1
+	SOLIDITY_SOLID = 2
+)
+
+const (
+	DRAW_OPAQUE = 0
+	DRAW_TRANSPARENT = 1
+	DRAW_TRANSPARENT_NO_CULLING = 2
+	DRAW_TRANSLUCENT = 3
+	DRAW_GAS = 4
+)
+
+const (
+	BLOCK_DEFINITIONS_FORMAT_VERSION = 0x02
+	BLOCK_DEFINITION_SIZE = 2 + serialization.STRING_LENGTH + 1 + 1 + 1 + 6 + 1 + 1 + 1 + 1 + 6 + 1 + 1 + 3 // ID, name, fallback, solidity, speed, textures, light, sound, full bright, sprite, bounding box, draw mode, fog
+	BLOCK_DEFINITION_SIZE_V1 = BLOCK_DEFINITION_SIZE - 1 // Format version 1 stores the ID as a byte
+)
+
+// A server-defined block (CPE BlockDefinitions)
+type BlockDefinition struct {
+	ID uint16
+	Name string
+	Fallback byte // Block shown to clients that do not support BlockDefinitions
+	Solidity byte
+	MovementSpeed byte // 128 is normal speed
+	TopTexture byte
+	LeftTexture byte
+	RightTexture byte
+	FrontTexture byte
+	BackTexture byte
+	BottomTexture byte
+	TransmitsLight bool
+	WalkSound byte
+	FullBright bool
+	Sprite bool // Sprites are drawn like flowers and saplings, and ignore the bounding box
+	MinX byte // Bounding box (0-16)
+	MinY byte
+	MinZ byte
+	MaxX byte
+	MaxY byte
+	MaxZ byte
+	BlockDraw byte
+	FogDensity byte
+	FogR byte
+	FogG byte
+	FogB byte
+}
+
+type BlockDefinitions map[uint16]BlockDefinition
+
+func CreateBlockDefinition(id uint16, name string, fallback byte) BlockDefinition {
+	return BlockDefinition{
+		ID: id,
+		Name: name,
+		Fallback: fallback,
+		Solidity: SOLIDITY_SOLID,
+		MovementSpeed: 128,
+		TopTexture: 1,
+		LeftTexture: 1,
+		RightTexture: 1,
+		FrontTexture: 1,
+		BackTexture: 1,
+		BottomTexture: 1,
+		WalkSound: 1,
+		MaxX: 16,
+		MaxY: 16,
+		MaxZ: 16,
+		BlockDraw: DRAW_OPAQUE,
+	}
+}
+
+func encodeBool(value bool) byte {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+func (definition BlockDefinition) Serialize() []byte {
+	buffer := make([]byte, BLOCK_DEFINITION_SIZE)
+
+	serialization.CopyData(0, serialization.EncodeShort(int(definition.ID)), buffer) // Block ID
+	serialization.CopyData(2, serialization.EncodeString(definition.Name), buffer) // Name
+
+	index := 2 + serialization.STRING_LENGTH
+
+	fields := []byte{
+		definition.Fallback,
+		definition.Solidity,
+		definition.MovementSpeed,
+		definition.TopTexture,
+		definition.LeftTexture,
+		definition.RightTexture,
+		definition.FrontTexture,
+		definition.BackTexture,
+		definition.BottomTexture,
+		encodeBool(definition.TransmitsLight),
+		definition.WalkSound,
+		encodeBool(definition.FullBright),
+		encodeBool(definition.Sprite),
+		definition.MinX,
+		definition.MinY,
+		definition.MinZ,
+		definition.MaxX,
+		definition.MaxY,
+		definition.MaxZ,
+		definition.BlockDraw,
+		definition.FogDensity,
+		definition.FogR,
+		definition.FogG,
+		definition.FogB,
+	}
+
+	serialization.CopyData(index, fields, buffer)
+
+	return buffer
+}
+
+func DeserializeBlockDefinition(data []byte, version byte) BlockDefinition {
+	id := uint16(data[0])
+	index := 1
+
+	if version >= 0x02 {
+		id = uint16(serialization.DecodeShort(data, 0))
+		index = 2
+	}
+
+	fields := data[index + serialization.STRING_LENGTH:]
+
+	return BlockDefinition{
+		ID: id,
+		Name: serialization.DecodeString(data, index),
+		Fallback: fields[0],
+		Solidity: fields[1],
+		MovementSpeed: fields[2],
+		TopTexture: fields[3],
+		LeftTexture: fields[4],
+		RightTexture: fields[5],
+		FrontTexture: fields[6],
+		BackTexture: fields[7],
+		BottomTexture: fields[8],
+		TransmitsLight: fields[9] != 0,
+		WalkSound: fields[10],
+		FullBright: fields[11] != 0,
+		Sprite: fields[12] != 0,
+		MinX: fields[13],
+		MinY: fields[14],
+		MinZ: fields[15],
+		MaxX: fields[16],
+		MaxY: fields[17],
+		MaxZ: fields[18],
+		BlockDraw: fields[19],
+		FogDensity: fields[20],
+		FogR: fields[21],
+		FogG: fields[22],
+		FogB: fields[23],
+	}
+}
+
+func (definitions BlockDefinitions) Serialize() []byte {
+	buffer := make([]byte, 6 + 1 + (BLOCK_DEFINITION_SIZE * len(definitions)))
+
+	serialization.CopyData(0, []byte("BLOCKS"), buffer) // Header
+	buffer[6] = BLOCK_DEFINITIONS_FORMAT_VERSION // Format Version
+
+	index := 7
+
+	for id := 0; id < BLOCK_COUNT; id++ {
+		definition, exists := definitions[uint16(id)]
+
+		if !exists {
+			continue
+		}
+
+		serialization.CopyData(index, definition.Serialize(), buffer)
+		index += BLOCK_DEFINITION_SIZE
+	}
+
+	return buffer
+}
+
+func DeserializeBlockDefinitions(data []byte) (BlockDefinitions, error) {
+	if len(data) < 7 || !bytes.Equal(data[0:6], []byte("BLOCKS")) {
+		return nil, errors.New("invalid block definitions format")
+	}
+
+	version := data[6]
+
+	if version == 0x00 || version > BLOCK_DEFINITIONS_FORMAT_VERSION {
+		return nil, errors.New("invalid block definitions format version")
+	}
+
+	size := BLOCK_DEFINITION_SIZE
+
+	if version == 0x01 {
+		size = BLOCK_DEFINITION_SIZE_V1
+	}
+
+	definitions := make(BlockDefinitions)
+
+	for index := 7; index + size <= len(data); index += size {
+		definition := DeserializeBlockDefinition(data[index:index + size], version)
+
+		if definition.ID > BLOCK_MAX_EXTENDED {
+			return nil, errors.New("invalid block ID")
+		}
+
+		definitions[definition.ID] = definition
+	}
+
+	return definitions, nil
+}
@@ -1,6 +1,7 @@
 package compression
 
 import (
+	"compress/flate"
 	"compress/gzip"
 	"io/ioutil"
 	"bytes"
@@ -26,20 +27,37 @@ func CompressData(source []byte) []byte {
 	return buf.Bytes()
 }
 
-func DecompressData(source []byte) []byte {
-	reader := bytes.NewReader(source)
+// Compresses the data with raw DEFLATE (no gzip header)
+func DeflateData(source []byte) []byte {
+	var buf bytes.Buffer
 	
-	gzreader, err := gzip.NewReader(reader)
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	
+	if err != nil {
+		panic(err)
+	}
+
+	_, err = zw.Write(source)
 	
 	if err != nil {
 		panic(err)
 	}
+
+	if err := zw.Close(); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
+
+func DecompressData(source []byte) ([]byte, error) {
+	reader := bytes.NewReader(source)
 	
-	output, err2 := ioutil.ReadAll(gzreader)
+	gzreader, err := gzip.NewReader(reader)
 	
-	if err2 != nil {
-		panic(err2)
+	if err != nil {
+		return nil, err
 	}
 	
-	return output
-}
\ No newline at end of file
+	return ioutil.ReadAll(gzreader)
+}
@@ -1,7 +1,8 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"sort"
 	"strings"
 	"strconv"
 )
@@ -15,43 +16,94 @@ func (config Config) Exists(key string) bool {
 	return exists
 }
 
-func (config Config) GetString(key string) string {
+func (config Config) GetString(key string) (string, error) {
 	data, exists := config.Data[key]
 	
 	if !exists {
-		log.Fatalln("Failed to read an option from server.properties: The option", key, "does not exist.")
+		return "", errors.New("the option " + key + " does not exist")
 	}
 	
-	return data
+	return data, nil
 }
 
-func (config Config) GetNumber(key string) int {
-	data, exists := config.Data[key]
+func (config Config) GetNumber(key string) (int, error) {
+	data, err := config.GetString(key)
 	
-	if !exists {
-		log.Fatalln("Failed to read an option from server.properties: The option", key, "does not exist.")
+	if err != nil {
+		return 0, err
 	}
 	
 	number, err := strconv.ParseInt(data, 10, 32)
 	
 	if err != nil {
-		log.Fatalln("Failed to read an option from server.properties: The option", key, "contains an invalid number value.")
+		return 0, errors.New("the option " + key + " contains an invalid number value")
 	}
 	
-	return int(number)
+	return int(number), nil
 }
 
-func (config Config) GetBoolean(key string) bool {
-	data, exists := config.Data[key]
+func (config Config) GetBoolean(key string) (bool, error) {
+	data, err := config.GetString(key)
 	
-	if !exists {
-		log.Fatalln("Failed to read an option from server.properties: The option", key, "does not exist.")
+	if err != nil {
+		return false, err
 	}
 	
-	return data == "true"
+	return data == "true", nil
+}
+
+// Options that are missing from older config files are read with a default value (numbers also use it if the value is invalid)
+
+func (config Config) GetStringDefault(key string, defaultValue string) string {
+	data, err := config.GetString(key)
+	
+	if err != nil {
+		return defaultValue
+	}
+	
+	return data
+}
+
+func (config Config) GetNumberDefault(key string, defaultValue int) int {
+	number, err := config.GetNumber(key)
+	
+	if err != nil {
+		return defaultValue
+	}
+	
+	return number
+}
+
+func (config Config) GetBooleanDefault(key string, defaultValue bool) bool {
+	boolean, err := config.GetBoolean(key)
+	
+	if err != nil {
+		return defaultValue
+	}
+	
+	return boolean
+}
+
+// Serializes the config as "key=value" lines, sorted by key
+func (config Config) Serialize() string {
+	keys := make([]string, 0, len(config.Data))
+	
+	for key := range config.Data {
+		keys = append(keys, key)
+	}
+	
+	sort.Strings(keys)
+	
+	data := ""
+	
+	for _, key := range keys {
+		data += key + "=" + config.Data[key] + "\n"
+	}
+	
+	return data
 }
 
-func ParseConfig(data string) Config {
+func ParseConfig(data string) (Config, error) {
 	lines := strings.Split(data, "\n")
 	
 	config := make(map[string]string)
@@ -64,15 +116,15 @@ func ParseConfig(data string) Config {
 		}
 		
 		if !strings.Contains(line, "=") {
-			log.Fatalln("Failed to parse server.properties: Line", i + 1, "does not contain the \"=\" character.")
+			return Config{}, errors.New("line " + strconv.Itoa(i + 1) + " does not contain the \"=\" character")
 		}
 		
-		parsedLine := strings.Split(line, "=")
+		parsedLine := strings.SplitN(line, "=", 2)
 		optionName := parsedLine[0]
 		optionValue := parsedLine[1]
 		
 		config[optionName] = optionValue
 	}
 	
-	return Config{config}
+	return Config{config}, nil
 }
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig("# comment\nname=Test=Server\nport=25565\nempty=\n\npublic=true")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name, err := config.GetString("name"); name != "Test=Server" || err != nil {
+		t.Errorf("name = %q, %v; want Test=Server", name, err)
+	}
+
+	if port, err := config.GetNumber("port"); port != 25565 || err != nil {
+		t.Errorf("port = %d, %v; want 25565", port, err)
+	}
+
+	if public, err := config.GetBoolean("public"); !public || err != nil {
+		t.Errorf("public = %t, %v; want true", public, err)
+	}
+
+	if empty, err := config.GetString("empty"); empty != "" || err != nil {
+		t.Errorf("empty = %q, %v; want a blank string", empty, err)
+	}
+}
+
+func TestParseConfigInvalidLine(t *testing.T) {
+	_, err := ParseConfig("name=Test\nport\n")
+
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("err = %v; want an error for line 2", err)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	config := Config{map[string]string{"port": "many"}}
+
+	if _, err := config.GetString("missing"); err == nil {
+		t.Error("GetString returned a missing option")
+	}
+
+	if _, err := config.GetNumber("missing"); err == nil {
+		t.Error("GetNumber returned a missing option")
+	}
+
+	if _, err := config.GetNumber("port"); err == nil {
+		t.Error("GetNumber returned an invalid number")
+	}
+
+	if _, err := config.GetBoolean("missing"); err == nil {
+		t.Error("GetBoolean returned a missing option")
+	}
+
+	if config.GetStringDefault("missing", "default") != "default" || config.GetNumberDefault("port", 25565) != 25565 || !config.GetBooleanDefault("missing", true) {
+		t.Error("missing or invalid options don't use the default value")
+	}
+}
+
+func TestSerialize(t *testing.T) {
+	config := Config{map[string]string{"b": "2", "a": "1"}}
+
+	if config.Serialize() != "a=1\nb=2\n" {
+		t.Fatalf("Serialize = %q", config.Serialize())
+	}
+
+	parsed, err := ParseConfig(config.Serialize())
+
+	if err != nil || len(parsed.Data) != 2 || parsed.Data["a"] != "1" {
+		t.Fatalf("parsed %v, %v", parsed.Data, err)
+	}
+}
@@ -0,0 +1,43 @@
+package event
+
+// Events that commands and gameplay features can subscribe to.
+// Handlers are called from the server goroutine, so they can access the server state.
+
+type PlayerClick struct {
+	PlayerID byte
+	Username string
+	Button byte
+	Action byte
+	Yaw int
+	Pitch int
+	TargetEntity byte // 0xff if no entity was clicked
+	TargetX int // -1 if no block was clicked
+	TargetY int
+	TargetZ int
+	TargetFace byte
+}
+
+type PlayerClickHandler func(click PlayerClick)
+
+// Each server has its own handlers
+type Handlers struct {
+	playerClick []PlayerClickHandler
+}
+
+func (handlers *Handlers) OnPlayerClick(handler PlayerClickHandler) {
+	handlers.playerClick = append(handlers.playerClick, handler)
+}
+
+func (handlers *Handlers) FirePlayerClick(click PlayerClick) {
+	for _, handler := range handlers.playerClick {
+		handler(click)
+	}
+}
+
+func (click PlayerClick) HasTargetEntity() bool {
+	return click.TargetEntity != 0xff
+}
+
+func (click PlayerClick) HasTargetBlock() bool {
+	return click.TargetX != -1 || click.TargetY != -1 || click.TargetZ != -1
+}
@@ -0,0 +1,82 @@
+package hacks
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	DEFAULT_JUMP_HEIGHT = -1
+)
+
+// Client-side hacks (CPE HackControl, and MOTD flags for older clients)
+type Hacks struct {
+	Flying bool
+	NoClip bool
+	Speeding bool
+	SpawnControl bool // Respawning and setting the spawnpoint
+	ThirdPerson bool
+	JumpHeight int // In 1/32 blocks (DEFAULT_JUMP_HEIGHT for the normal jump height)
+}
+
+var NAMES = []string{"fly", "noclip", "speed", "respawn", "thirdperson"}
+
+func AllowAll() Hacks {
+	return Hacks{true, true, true, true, true, DEFAULT_JUMP_HEIGHT}
+}
+
+func AllowNone() Hacks {
+	return Hacks{false, false, false, false, false, DEFAULT_JUMP_HEIGHT}
+}
+
+// Returns a pointer to the hack with the given name (or nil if it doesn't exist)
+func (hacks *Hacks) Get(name string) *bool {
+	switch name {
+	case "fly":
+		return &hacks.Flying
+	case "noclip":
+		return &hacks.NoClip
+	case "speed":
+		return &hacks.Speeding
+	case "respawn":
+		return &hacks.SpawnControl
+	case "thirdperson":
+		return &hacks.ThirdPerson
+	}
+
+	return nil
+}
+
+// Hacks are allowed if either set allows them. The jump height comes from the first set.
+func (hacks Hacks) Or(other Hacks) Hacks {
+	return Hacks{
+		hacks.Flying || other.Flying,
+		hacks.NoClip || other.NoClip,
+		hacks.Speeding || other.Speeding,
+		hacks.SpawnControl || other.SpawnControl,
+		hacks.ThirdPerson || other.ThirdPerson,
+		hacks.JumpHeight,
+	}
+}
+
+// Flags that are added to the MOTD for clients that do not support HackControl (e.g. "-fly -noclip jumpheight=2")
+func (hacks Hacks) MOTDFlags() string {
+	flags := make([]string, 0)
+
+	for _, name := range NAMES {
+		if !*hacks.Get(name) {
+			flags = append(flags, "-"+name)
+		}
+	}
+
+	if len(flags) == len(NAMES) {
+		flags = []string{"-hax"}
+	}
+
+	// The MOTD jump height is in blocks
+	if hacks.JumpHeight != DEFAULT_JUMP_HEIGHT {
+		flags = append(flags, "jumpheight="+strconv.FormatFloat(float64(hacks.JumpHeight) / 32, 'f', -1, 64))
+	}
+
+	return strings.Join(flags, " ")
+}
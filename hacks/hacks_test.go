@@ -0,0 +1,34 @@
+package hacks
+
+import (
+	"testing"
+)
+
+func TestMOTDFlags(t *testing.T) {
+	noFlying := AllowAll()
+	noFlying.Flying = false
+	noFlying.NoClip = false
+
+	highJump := AllowAll()
+	highJump.JumpHeight = 64
+
+	noHacksHalfJump := AllowNone()
+	noHacksHalfJump.JumpHeight = 16
+
+	tests := []struct {
+		hacks Hacks
+		flags string
+	}{
+		{AllowAll(), ""},
+		{AllowNone(), "-hax"},
+		{noFlying, "-fly -noclip"},
+		{highJump, "jumpheight=2"},
+		{noHacksHalfJump, "-hax jumpheight=0.5"},
+	}
+
+	for _, test := range tests {
+		if flags := test.hacks.MOTDFlags(); flags != test.flags {
+			t.Errorf("%+v: MOTDFlags = %q; want %q", test.hacks, flags, test.flags)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package hotkeys
+
+import (
+	"strings"
+)
+
+const (
+	MOD_CTRL = 1
+	MOD_SHIFT = 2
+	MOD_ALT = 4
+)
+
+// A key that makes the client send a chat message or command (CPE TextHotKey)
+type HotKey struct {
+	Key string // Key name, with modifiers (for example "ctrl+F5")
+	KeyCode int // LWJGL key code
+	KeyMods byte
+	Action string // Sent by the client when the key is pressed
+}
+
+// LWJGL key codes
+var KEY_CODES = map[string]int{
+	"1": 2, "2": 3, "3": 4, "4": 5, "5": 6, "6": 7, "7": 8, "8": 9, "9": 10, "0": 11,
+	"Q": 16, "W": 17, "E": 18, "R": 19, "T": 20, "Y": 21, "U": 22, "I": 23, "O": 24, "P": 25,
+	"A": 30, "S": 31, "D": 32, "F": 33, "G": 34, "H": 35, "J": 36, "K": 37, "L": 38,
+	"Z": 44, "X": 45, "C": 46, "V": 47, "B": 48, "N": 49, "M": 50,
+	"F1": 59, "F2": 60, "F3": 61, "F4": 62, "F5": 63, "F6": 64, "F7": 65, "F8": 66, "F9": 67, "F10": 68, "F11": 87, "F12": 88,
+}
+
+var MOD_NAMES = map[string]byte{
+	"ctrl": MOD_CTRL,
+	"shift": MOD_SHIFT,
+	"alt": MOD_ALT,
+}
+
+// Parses a key name such as "F5" or "ctrl+shift+K"
+func ParseKey(key string) (int, byte, bool) {
+	parts := strings.Split(key, "+")
+	mods := byte(0)
+
+	for _, part := range parts[:len(parts) - 1] {
+		mod, exists := MOD_NAMES[strings.ToLower(part)]
+
+		if !exists {
+			return 0, 0, false
+		}
+
+		mods |= mod
+	}
+
+	keyCode, exists := KEY_CODES[strings.ToUpper(parts[len(parts) - 1])]
+
+	return keyCode, mods, exists
+}
+
+func CreateHotKey(key string, action string) (HotKey, bool) {
+	keyCode, mods, ok := ParseKey(key)
+	return HotKey{key, keyCode, mods, action}, ok
+}
+
+// Adds the hot key, replacing a hot key for the same key. An empty action removes the hot key.
+func Set(list []HotKey, hotKey HotKey) []HotKey {
+	output := make([]HotKey, 0, len(list) + 1)
+
+	for _, existing := range list {
+		if existing.KeyCode != hotKey.KeyCode || existing.KeyMods != hotKey.KeyMods {
+			output = append(output, existing)
+		}
+	}
+
+	if len(hotKey.Action) != 0 {
+		output = append(output, hotKey)
+	}
+
+	return output
+}
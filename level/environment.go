@@ -0,0 +1,206 @@
+package level
+
+import (
+	"fmt"
+	"goserver/blocks"
+	"strconv"
+	"strings"
+)
+
+const (
+	WEATHER_SUN = 0
+	WEATHER_RAIN = 1
+	WEATHER_SNOW = 2
+)
+
+var WEATHER_NAMES = []string{"sun", "rain", "snow"}
+
+// Colors are -1, -1, -1 for the client's default color
+type Color struct {
+	R int
+	G int
+	B int
+}
+
+var DEFAULT_COLOR = Color{-1, -1, -1}
+
+// Environment settings (CPE EnvColors, EnvMapAspect and EnvWeatherType)
+type Environment struct {
+	SkyColor Color
+	CloudColor Color
+	FogColor Color
+	AmbientColor Color // Shadow color
+	DiffuseColor Color // Sunlight color
+	SideBlock uint16 // Block below the water level outside of the level
+	EdgeBlock uint16 // Block at the water level outside of the level
+	WaterLevel int // -1 for half of the level height
+	CloudsHeight int // -1 for 2 blocks above the level
+	TexturePackURL string
+	Weather byte
+}
+
+// Environment property names used by level metadata and commands
+var ENVIRONMENT_PROPERTIES = []string{"sky", "cloud", "fog", "ambient", "diffuse", "side", "edge", "waterlevel", "cloudsheight", "texturepack", "weather"}
+
+func DefaultEnvironment() Environment {
+	return Environment{
+		DEFAULT_COLOR,
+		DEFAULT_COLOR,
+		DEFAULT_COLOR,
+		DEFAULT_COLOR,
+		DEFAULT_COLOR,
+		blocks.BLOCK_BEDROCK,
+		blocks.BLOCK_STATIONARY_WATER,
+		-1,
+		-1,
+		"",
+		WEATHER_SUN,
+	}
+}
+
+func (environment *Environment) color(property string) *Color {
+	switch property {
+	case "sky":
+		return &environment.SkyColor
+	case "cloud":
+		return &environment.CloudColor
+	case "fog":
+		return &environment.FogColor
+	case "ambient":
+		return &environment.AmbientColor
+	case "diffuse":
+		return &environment.DiffuseColor
+	}
+
+	return nil
+}
+
+func (color Color) String() string {
+	if color == DEFAULT_COLOR {
+		return "default"
+	}
+
+	return fmt.Sprintf("%02x%02x%02x", color.R, color.G, color.B)
+}
+
+// Parses a hex color ("ff8000" or "#ff8000") or "default"
+func ParseColor(value string) (Color, bool) {
+	if value == "default" {
+		return DEFAULT_COLOR, true
+	}
+
+	value = strings.TrimPrefix(value, "#")
+
+	if len(value) != 6 {
+		return Color{}, false
+	}
+
+	number, err := strconv.ParseUint(value, 16, 32)
+
+	if err != nil {
+		return Color{}, false
+	}
+
+	return Color{int(number >> 16) & 0xff, int(number >> 8) & 0xff, int(number) & 0xff}, true
+}
+
+func (environment Environment) Get(property string) string {
+	if color := environment.color(property); color != nil {
+		return color.String()
+	}
+
+	switch property {
+	case "side":
+		return strconv.Itoa(int(environment.SideBlock))
+	case "edge":
+		return strconv.Itoa(int(environment.EdgeBlock))
+	case "waterlevel":
+		return strconv.Itoa(environment.WaterLevel)
+	case "cloudsheight":
+		return strconv.Itoa(environment.CloudsHeight)
+	case "texturepack":
+		return environment.TexturePackURL
+	case "weather":
+		return WEATHER_NAMES[environment.Weather]
+	}
+
+	return ""
+}
+
+// Returns false if the property doesn't exist or the value is invalid
+func (environment *Environment) Set(property string, value string) bool {
+	if color := environment.color(property); color != nil {
+		parsedColor, ok := ParseColor(value)
+
+		if ok {
+			*color = parsedColor
+		}
+
+		return ok
+	}
+
+	switch property {
+	case "side", "edge":
+		block, err := strconv.ParseUint(value, 10, 16)
+
+		if err != nil || block > blocks.BLOCK_MAX_EXTENDED {
+			return false
+		}
+
+		if property == "side" {
+			environment.SideBlock = uint16(block)
+		} else {
+			environment.EdgeBlock = uint16(block)
+		}
+
+		return true
+	case "waterlevel", "cloudsheight":
+		height, err := strconv.Atoi(value)
+
+		if err != nil || height < -1 {
+			return false
+		}
+
+		if property == "waterlevel" {
+			environment.WaterLevel = height
+		} else {
+			environment.CloudsHeight = height
+		}
+
+		return true
+	case "texturepack":
+		if len(value) > 64 {
+			return false
+		}
+
+		environment.TexturePackURL = value
+		return true
+	case "weather":
+		for i, name := range WEATHER_NAMES {
+			if value == name {
+				environment.Weather = byte(i)
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return false
+}
+
+func (level Level) EffectiveWaterLevel() int {
+	if level.Environment.WaterLevel == -1 {
+		return level.Height / 2
+	}
+
+	return level.Environment.WaterLevel
+}
+
+func (level Level) EffectiveCloudsHeight() int {
+	if level.Environment.CloudsHeight == -1 {
+		return level.Height + 2
+	}
+
+	return level.Environment.CloudsHeight
+}
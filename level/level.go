@@ -5,9 +5,19 @@ import (
 	"goserver/serialization"
 	"goserver/blocks"
 	"crypto/sha256"
+	"errors"
+	"fmt"
 	"log"
+	"os"
 	"bytes"
+	"sync"
 	"time"
+	"goserver/compression"
+	"goserver/hacks"
+	"goserver/hotkeys"
+	"goserver/permissions"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -16,6 +26,11 @@ const (
 	LEVEL_EXPERIMENTAL = 2
 )
 
+const (
+	LEVEL_FORMAT_VERSION = 0x04
+	DEFAULT_CLICK_DISTANCE = 160 // 5 blocks
+)
+
 const (
 	LEVEL_TYPE_NORMAL = 0 // Normal levels contain the level data and nothing else.
 	LEVEL_TYPE_CHAIN = 1 // Chain levels contain a chain of block updates instead of the level data. Very useful if you need to do a level rollback.
@@ -25,17 +40,110 @@ type Level struct {
 	Width int // X size
 	Height int // Y size
 	Depth int // Z size
-	Data []byte // block array
+	Data []byte // block array (lower 8 bits of the block IDs)
+	ExtendedData []byte // upper bits of the block IDs (nil if the level has no blocks above 255)
 	Spawnpoint Spawnpoint // Spawnpoint
 	Type int // Level type
 	Chain []BlockUpdate // Chain data
+	Hacks hacks.Hacks // Hacks that players are allowed to use
+	Permissions permissions.Permissions // Blocks that players are not allowed to place or break
+	ClickDistance int // Reach in 1/32 blocks
+	HotKeys []hotkeys.HotKey // Hot keys that are sent to clients
+	Environment Environment // Environment settings
+	cache *levelCache // Cached level data (FastMap)
+	lastUpdates map[int]BlockUpdate // Block array index -> last block update at the position (also kept in normal levels, but only saved in chain levels)
+}
+
+// Block conversion table, and whether the upper bits of the block IDs are sent (ExtendedBlocks)
+type ConversionTable struct {
+	Blocks [blocks.BLOCK_COUNT]uint16
+	Extended bool
+}
+
+type levelCache struct {
+	mutex sync.Mutex
+	deflated map[ConversionTable][]byte // Block conversion table -> DEFLATE compressed block array
+}
+
+var ErrInvalidFormat = errors.New("invalid level format")
+var ErrUnsupportedVersion = errors.New("unsupported level format version, please update goserver")
+var ErrTruncatedLevel = errors.New("level file is truncated")
+
+func levelLogger(logger *log.Logger) *log.Logger {
+	if logger == nil {
+		return log.New(os.Stderr, "", log.LstdFlags)
+	}
+	
+	return logger
+}
+
+func createLevelCache() *levelCache {
+	return &levelCache{deflated: make(map[ConversionTable][]byte)}
+}
+
+// Prepares a level that wasn't created by GenerateLevel or DeserializeLevel (like one built by a program that embeds the server).
+// Missing block arrays, permissions and caches are created, and a zero click distance or environment is replaced with the default.
+func (level *Level) Prepare() error {
+	if level.Width <= 0 || level.Height <= 0 || level.Depth <= 0 {
+		return errors.New("the level size must be positive")
+	}
+	
+	volume := level.Width * level.Height * level.Depth
+	
+	if level.Data == nil {
+		level.Data = make([]byte, volume)
+	}
+	
+	if len(level.Data) != volume || (level.ExtendedData != nil && len(level.ExtendedData) != volume) {
+		return errors.New("the block array doesn't match the level size")
+	}
+	
+	if level.Chain == nil {
+		level.Chain = make([]BlockUpdate, 0)
+	}
+	
+	if level.Permissions.DeniedPlace == nil {
+		level.Permissions.DeniedPlace = make(map[uint16]bool)
+	}
+	
+	if level.Permissions.DeniedBreak == nil {
+		level.Permissions.DeniedBreak = make(map[uint16]bool)
+	}
+	
+	if level.ClickDistance == 0 {
+		level.ClickDistance = DEFAULT_CLICK_DISTANCE
+	}
+	
+	if level.HotKeys == nil {
+		level.HotKeys = make([]hotkeys.HotKey, 0)
+	}
+	
+	if level.Environment == (Environment{}) {
+		level.Environment = DefaultEnvironment()
+	}
+	
+	if level.cache == nil {
+		level.cache = createLevelCache()
+	}
+	
+	if level.lastUpdates == nil {
+		level.lastUpdates = make(map[int]BlockUpdate)
+		
+		for _, block := range level.Chain {
+			if !level.IsOOB(block.X, block.Y, block.Z) {
+				level.lastUpdates[level.Index(block.X, block.Y, block.Z)] = block
+			}
+		}
+	}
+	
+	return nil
 }
 
 type BlockUpdate struct {
 	X int // X
 	Y int // Y
 	Z int // Z
-	ID byte // Block ID
+	ID uint16 // Block ID
 	Name string // Player name (or blank if it is not by a player)
 	PreviousBlock []byte // Hash of the previous block in the chain
 }
@@ -48,31 +156,67 @@ type Spawnpoint struct {
 	Pitch byte
 }
 
-func (blockUpdate BlockUpdate) Serialize() []byte {
-	buffer := make([]byte, 2 + 2 + 2 + 1 + serialization.STRING_LENGTH + serialization.HASH_LENGTH)
+// Format version 4 stores the block ID of chain blocks as a short (ExtendedBlocks)
+func blockUpdateSize(version byte) int {
+	if version < 0x04 {
+		return 2 + 2 + 2 + 1 + serialization.STRING_LENGTH + serialization.HASH_LENGTH
+	}
+	
+	return 2 + 2 + 2 + 2 + serialization.STRING_LENGTH + serialization.HASH_LENGTH
+}
+
+func (blockUpdate BlockUpdate) serialize(version byte) []byte {
+	buffer := make([]byte, blockUpdateSize(version))
 	
 	serialization.CopyData(0, serialization.EncodeShort(blockUpdate.X), buffer) // X
 	serialization.CopyData(2, serialization.EncodeShort(blockUpdate.Y), buffer) // Y
 	serialization.CopyData(4, serialization.EncodeShort(blockUpdate.Z), buffer) // Z
 	
-	buffer[6] = blockUpdate.ID // Block ID
+	index := 6
+	
+	if version < 0x04 {
+		buffer[index] = byte(blockUpdate.ID) // Block ID
+		index += 1
+	} else {
+		serialization.CopyData(index, serialization.EncodeShort(int(blockUpdate.ID)), buffer) // Block ID
+		index += 2
+	}
 	
-	serialization.CopyData(7, serialization.EncodeString(blockUpdate.Name), buffer) // Player name (or blank if it is not by a player)
-	serialization.CopyData(7 + serialization.STRING_LENGTH, blockUpdate.PreviousBlock, buffer) // Hash of the previous block in the chain
+	serialization.CopyData(index, serialization.EncodeString(blockUpdate.Name), buffer) // Player name (or blank if it is not by a player)
+	serialization.CopyData(index + serialization.STRING_LENGTH, blockUpdate.PreviousBlock, buffer) // Hash of the previous block in the chain
 	
 	return buffer
 }
 
-func DeserializeBlockUpdate(data []byte) BlockUpdate {
+func (blockUpdate BlockUpdate) Serialize() []byte {
+	return blockUpdate.serialize(LEVEL_FORMAT_VERSION)
+}
+
+// Blocks up to 255 are hashed in the format version 1 layout, so that the hashes of chains saved by older versions stay valid
+func (blockUpdate BlockUpdate) Hash() [32]byte {
+	if blockUpdate.ID > blocks.BLOCK_MAX_BYTE {
+		return sha256.Sum256(blockUpdate.Serialize())
+	}
+	
+	return sha256.Sum256(blockUpdate.serialize(0x01))
+}
+
+func DeserializeBlockUpdate(data []byte, version byte) BlockUpdate {
 	x := serialization.DecodeShort(data, 0) // X
 	y := serialization.DecodeShort(data, 2) // Y
 	z := serialization.DecodeShort(data, 4) // Z
 	
-	id := data[6] // Block ID
+	id := uint16(data[6]) // Block ID
+	index := 7
+	
+	if version >= 0x04 {
+		id = uint16(serialization.DecodeShort(data, 6)) // Block ID
+		index = 8
+	}
 	
-	name := serialization.DecodeString(data, 7) // Player name (or blank if it is not by a player)
+	name := serialization.DecodeString(data, index) // Player name (or blank if it is not by a player)
 	
-	hashIndex := 7 + serialization.STRING_LENGTH
+	hashIndex := index + serialization.STRING_LENGTH
 	hashEndIndex := hashIndex + serialization.HASH_LENGTH
 	previousBlock := data[hashIndex:hashEndIndex] // Hash of the previous block in the chain
 	
@@ -80,38 +224,112 @@ func DeserializeBlockUpdate(data []byte) BlockUpdate {
 }
 
 func (level Level) IsOOB(x int, y int, z int) bool {
-	if (y * level.Depth + z) * level.Width + x > len(level.Data) - 1 {
-		return true
+	return x < 0 || y < 0 || z < 0 || x >= level.Width || y >= level.Height || z >= level.Depth
+}
+
+// Returns the last block update at the position. Normal levels don't save their block updates, so only the updates since the level was loaded are available.
+func (level Level) LastBlockUpdate(x int, y int, z int) (BlockUpdate, bool) {
+	if level.IsOOB(x, y, z) {
+		return BlockUpdate{}, false
 	}
 	
-	return false
+	block, exists := level.lastUpdates[level.Index(x, y, z)]
+	return block, exists
 }
 
-func (level Level) GetBlock(x int, y int, z int) byte {
+func (level Level) GetBlock(x int, y int, z int) uint16 {
 	if level.IsOOB(x, y, z) {
 		return blocks.BLOCK_AIR
 	}
 
-	return level.Data[(y * level.Depth + z) * level.Width + x]
+	return level.blockAt(level.Index(x, y, z))
 }
 
-func (level *Level) SetBlock(x int, y int, z int, id byte) {
+func (level Level) blockAt(index int) uint16 {
+	if level.ExtendedData == nil {
+		return uint16(level.Data[index])
+	}
+	
+	return uint16(level.Data[index]) | (uint16(level.ExtendedData[index]) << 8)
+}
+
+func (level *Level) setBlockAt(index int, id uint16) {
+	// The upper bits are only stored once the level contains a block above 255
+	if id > blocks.BLOCK_MAX_BYTE && level.ExtendedData == nil {
+		level.ExtendedData = make([]byte, len(level.Data))
+	}
+	
+	level.Data[index] = byte(id)
+	
+	if level.ExtendedData != nil {
+		level.ExtendedData[index] = byte(id >> 8)
+	}
+}
+
+func (level *Level) SetBlock(x int, y int, z int, id uint16) {
 	level.SetBlockPlayer(x, y, z, id, "")
 }
 
-func (level *Level) SetBlockPlayer(x int, y int, z int, id byte, name string) {	
-	level.Data[(y * level.Depth + z) * level.Width + x] = id
+func (level *Level) SetBlockPlayer(x int, y int, z int, id uint16, name string) {	
+	level.setBlockAt(level.Index(x, y, z), id)
+	level.cache.invalidate()
 	
 	if level.Type == LEVEL_TYPE_CHAIN {
 		block := BlockUpdate{x, y, z, id, name, make([]byte, 32)}
 		
 		if len(level.Chain) != 0 {
-			previousBlockHash := sha256.Sum256(level.Chain[len(level.Chain) - 1].Serialize())
+			previousBlockHash := level.Chain[len(level.Chain) - 1].Hash()
 			block.PreviousBlock = previousBlockHash[:]
 		}
 		
 		level.Chain = append(level.Chain, block)
+		level.lastUpdates[level.Index(x, y, z)] = block
+		return
 	}
+	
+	level.lastUpdates[level.Index(x, y, z)] = BlockUpdate{x, y, z, id, name, nil}
+}
+
+// Collects block changes so that they can be sent to clients together (BulkBlockUpdate)
+type BlockBatch struct {
+	Level *Level
+	Name string // Player name (or blank if it is not by a player)
+	Indices []int // Block array indices
+	Blocks []uint16 // Block IDs
+	positions map[int]int // Block array index -> position in Indices and Blocks
+}
+
+func (level *Level) CreateBlockBatch(name string) *BlockBatch {
+	return &BlockBatch{level, name, make([]int, 0), make([]uint16, 0), make(map[int]int)}
+}
+
+func (level Level) Index(x int, y int, z int) int {
+	return (y * level.Depth + z) * level.Width + x
+}
+
+// Changes the block in the level, and adds it to the batch (blocks that are changed more than once are only sent once)
+func (batch *BlockBatch) SetBlock(x int, y int, z int, id uint16) {
+	if batch.Level.IsOOB(x, y, z) {
+		return
+	}
+	
+	batch.Level.SetBlockPlayer(x, y, z, id, batch.Name)
+	
+	index := batch.Level.Index(x, y, z)
+	position, exists := batch.positions[index]
+	
+	if exists {
+		batch.Blocks[position] = id
+		return
+	}
+	
+	batch.positions[index] = len(batch.Indices)
+	batch.Indices = append(batch.Indices, index)
+	batch.Blocks = append(batch.Blocks, id)
+}
+
+func (batch *BlockBatch) Len() int {
+	return len(batch.Indices)
 }
 
 func (level Level) Encode() []byte {
@@ -123,90 +341,340 @@ func (level Level) Encode() []byte {
 	return buffer
 }
 
-func (level Level) Serialize() []byte {
-	if level.Type == LEVEL_TYPE_CHAIN {
-		blockSize := 2 + 2 + 2 + 1 + serialization.STRING_LENGTH + serialization.HASH_LENGTH
-		
-		buffer := make([]byte, 5 + 1 + 2 + 2 + 2 + 2 + 2 + 2 + 1 + 1 + (blockSize * len(level.Chain)))
+func (cache *levelCache) invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
 	
-		serialization.CopyData(0, []byte("CHAIN"), buffer) // Header
-		buffer[5] = 0x01 // Format Version
+	if len(cache.deflated) != 0 {
+		cache.deflated = make(map[ConversionTable][]byte)
+	}
+}
+
+// Returns the block array with every block replaced using the conversion table (used for clients that do not support some blocks).
+// If the table is extended and a converted block is above 255, a second array with the upper bits of the block IDs follows the first one (ExtendedBlocks).
+func (level Level) convert(table ConversionTable) []byte {
+	volume := len(level.Data)
+	buffer := make([]byte, volume * 2)
+	extended := false
+	
+	for i := 0; i < volume; i++ {
+		id := table.Blocks[level.blockAt(i)]
+		buffer[i] = byte(id)
 		
-		serialization.CopyData(6, serialization.EncodeShort(level.Width), buffer) // Width
-		serialization.CopyData(8, serialization.EncodeShort(level.Height), buffer) // Height
-		serialization.CopyData(10, serialization.EncodeShort(level.Depth), buffer) // Depth
+		if table.Extended && id > blocks.BLOCK_MAX_BYTE {
+			buffer[volume + i] = byte(id >> 8)
+			extended = true
+		}
+	}
 	
-		serialization.CopyData(12, serialization.EncodeShort(level.Spawnpoint.X), buffer) // Spawn X
-		serialization.CopyData(14, serialization.EncodeShort(level.Spawnpoint.Y), buffer) // Spawn Y
-		serialization.CopyData(16, serialization.EncodeShort(level.Spawnpoint.Z), buffer) // Spawn Z
+	if !extended {
+		return buffer[:volume]
+	}
 	
-		buffer[18] = byte(level.Spawnpoint.Yaw) // Spawn Yaw
-		buffer[19] = byte(level.Spawnpoint.Pitch) // Spawn Pitch
+	return buffer
+}
 
-		for i := 0; i < len(level.Chain); i++ {
-			serialization.CopyData(20 + (blockSize * i), level.Chain[i].Serialize(), buffer) // Block
+// Encodes the converted block array with the length prefix
+func (level Level) EncodeConverted(table ConversionTable) []byte {
+	data := level.convert(table)
+	buffer := make([]byte, 4 + len(data))
+	
+	serialization.CopyData(0, serialization.EncodeInt(len(level.Data)), buffer)
+	serialization.CopyData(4, data, buffer)
+	
+	return buffer
+}
+
+// Compresses the converted block array (without the length prefix) with DEFLATE, for clients that support FastMap.
+// The compressed data is cached until the level changes.
+func (level Level) DeflateConverted(table ConversionTable) []byte {
+	level.cache.mutex.Lock()
+	defer level.cache.mutex.Unlock()
+	
+	data, exists := level.cache.deflated[table]
+	
+	if exists {
+		return data
+	}
+	
+	data = compression.DeflateData(level.convert(table))
+	level.cache.deflated[table] = data
+	
+	return data
+}
+
+// Level header: header bytes, byte (format version), level size, spawnpoint position, byte, byte (spawnpoint yaw & pitch)
+// Format version 1 stores the level size and spawnpoint position as shorts, format version 2 stores them as ints (for levels larger than 65535 blocks)
+// Format version 3 adds a metadata section after the header (hacks, block permissions, click distance, hot keys and environment settings): int (metadata length), then "key=value" lines
+// Format version 4 adds the upper bits of the block IDs after the block array of normal levels (only if the level has blocks above 255), and stores chain block IDs as shorts
+func levelHeaderSize(version byte) int {
+	if version == 0x01 {
+		return 5 + 1 + 2 + 2 + 2 + 2 + 2 + 2 + 1 + 1
+	}
+	
+	return 5 + 1 + 4 + 4 + 4 + 4 + 4 + 4 + 1 + 1
+}
+
+func (level Level) serializeMetadata() []byte {
+	lines := make([]string, 0)
+	
+	for _, name := range hacks.NAMES {
+		lines = append(lines, "hacks." + name + "=" + strconv.FormatBool(*level.Hacks.Get(name)))
+	}
+	
+	lines = append(lines, "hacks.jumpheight=" + strconv.Itoa(level.Hacks.JumpHeight))
+	
+	lines = append(lines, "permissions.place=" + permissions.FormatBlocks(level.Permissions.DeniedPlace))
+	lines = append(lines, "permissions.break=" + permissions.FormatBlocks(level.Permissions.DeniedBreak))
+	
+	lines = append(lines, "clickdistance=" + strconv.Itoa(level.ClickDistance))
+	
+	for _, hotKey := range level.HotKeys {
+		lines = append(lines, "hotkey." + hotKey.Key + "=" + hotKey.Action)
+	}
+	
+	for _, property := range ENVIRONMENT_PROPERTIES {
+		lines = append(lines, "env." + property + "=" + level.Environment.Get(property))
+	}
+	
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func (level *Level) deserializeMetadata(metadata []byte, logger *log.Logger) {
+	for _, line := range strings.Split(string(metadata), "\n") {
+		parsedLine := strings.SplitN(line, "=", 2)
+		
+		if len(parsedLine) != 2 {
+			continue
 		}
 		
-		return buffer
+		key := parsedLine[0]
+		value := parsedLine[1]
+		
+		if strings.HasPrefix(key, "hacks.") {
+			if key == "hacks.jumpheight" {
+				jumpHeight, err := strconv.Atoi(value)
+				
+				if err == nil {
+					level.Hacks.JumpHeight = jumpHeight
+				}
+				
+				continue
+			}
+			
+			if hack := level.Hacks.Get(strings.TrimPrefix(key, "hacks.")); hack != nil {
+				*hack = value == "true"
+			}
+			
+			continue
+		}
+		
+		if key == "permissions.place" || key == "permissions.break" {
+			set, ok := permissions.ParseBlocks(value)
+			
+			if !ok {
+				logger.Println("Invalid level metadata:", key)
+				continue
+			}
+			
+			if key == "permissions.place" {
+				level.Permissions.DeniedPlace = set
+			} else {
+				level.Permissions.DeniedBreak = set
+			}
+			
+			continue
+		}
+		
+		if key == "clickdistance" {
+			clickDistance, err := strconv.Atoi(value)
+			
+			if err == nil {
+				level.ClickDistance = clickDistance
+			}
+			
+			continue
+		}
+		
+		if strings.HasPrefix(key, "hotkey.") {
+			hotKey, ok := hotkeys.CreateHotKey(strings.TrimPrefix(key, "hotkey."), value)
+			
+			if !ok {
+				logger.Println("Invalid level metadata:", key)
+				continue
+			}
+			
+			level.HotKeys = hotkeys.Set(level.HotKeys, hotKey)
+			continue
+		}
+		
+		if strings.HasPrefix(key, "env.") {
+			if !level.Environment.Set(strings.TrimPrefix(key, "env."), value) {
+				logger.Println("Invalid level metadata:", key)
+			}
+			
+			continue
+		}
+		
+		logger.Println("Unknown level metadata:", key)
+	}
+}
+
+// Reads the metadata section (if the format version has one) and returns the index of the level data
+func (level *Level) readMetadata(data []byte, headerSize int, logger *log.Logger) (int, error) {
+	if data[5] < 0x03 {
+		return headerSize, nil
+	}
+	
+	if len(data) < headerSize + 4 {
+		return 0, ErrTruncatedLevel
+	}
+	
+	length := serialization.DecodeInt(data, headerSize)
+	
+	if length < 0 || len(data) - headerSize - 4 < length {
+		return 0, ErrTruncatedLevel
 	}
 	
-	buffer := make([]byte, 5 + 1 + 2 + 2 + 2 + 2 + 2 + 2 + 1 + 1 + len(level.Data))
+	level.deserializeMetadata(data[headerSize + 4:headerSize + 4 + length], logger)
+	
+	return headerSize + 4 + length, nil
+}
+
+// Returns the header and metadata, with extraSize bytes of space after them for the level data
+func (level Level) serializeHeader(header string, extraSize int) []byte {
+	metadata := level.serializeMetadata()
+	headerSize := levelHeaderSize(LEVEL_FORMAT_VERSION)
+	
+	buffer := make([]byte, headerSize + 4 + len(metadata) + extraSize)
 	
-	serialization.CopyData(0, []byte("LEVEL"), buffer) // Header
-	buffer[5] = 0x01 // Format Version
+	serialization.CopyData(0, []byte(header), buffer) // Header
+	buffer[5] = LEVEL_FORMAT_VERSION // Format Version
 	
-	serialization.CopyData(6, serialization.EncodeShort(level.Width), buffer) // Width
-	serialization.CopyData(8, serialization.EncodeShort(level.Height), buffer) // Height
-	serialization.CopyData(10, serialization.EncodeShort(level.Depth), buffer) // Depth
+	serialization.CopyData(6, serialization.EncodeInt(level.Width), buffer) // Width
+	serialization.CopyData(10, serialization.EncodeInt(level.Height), buffer) // Height
+	serialization.CopyData(14, serialization.EncodeInt(level.Depth), buffer) // Depth
 	
-	serialization.CopyData(12, serialization.EncodeShort(level.Spawnpoint.X), buffer) // Spawn X
-	serialization.CopyData(14, serialization.EncodeShort(level.Spawnpoint.Y), buffer) // Spawn Y
-	serialization.CopyData(16, serialization.EncodeShort(level.Spawnpoint.Z), buffer) // Spawn Z
+	serialization.CopyData(18, serialization.EncodeInt(level.Spawnpoint.X), buffer) // Spawn X
+	serialization.CopyData(22, serialization.EncodeInt(level.Spawnpoint.Y), buffer) // Spawn Y
+	serialization.CopyData(26, serialization.EncodeInt(level.Spawnpoint.Z), buffer) // Spawn Z
 	
-	buffer[18] = byte(level.Spawnpoint.Yaw) // Spawn Yaw
-	buffer[19] = byte(level.Spawnpoint.Pitch) // Spawn Pitch
+	buffer[30] = byte(level.Spawnpoint.Yaw) // Spawn Yaw
+	buffer[31] = byte(level.Spawnpoint.Pitch) // Spawn Pitch
 	
-	serialization.CopyData(20, level.Data, buffer)
+	serialization.CopyData(headerSize, serialization.EncodeInt(len(metadata)), buffer) // Metadata Length
+	serialization.CopyData(headerSize + 4, metadata, buffer) // Metadata
 	
 	return buffer
 }
 
-func DeserializeLevel(data []byte) Level {
-	if bytes.Equal(data[0:5], []byte("CHAIN")) {
-		//log.Println("DeserializeLevel(): Level type: Chain")
+func deserializeHeader(data []byte) (int, int, int, Spawnpoint, int, error) {
+	version := data[5]
+	
+	if version == 0x00 || version > LEVEL_FORMAT_VERSION {
+		return 0, 0, 0, Spawnpoint{}, 0, ErrUnsupportedVersion
+	}
+	
+	if len(data) < levelHeaderSize(version) {
+		return 0, 0, 0, Spawnpoint{}, 0, ErrTruncatedLevel
+	}
+	
+	if version == 0x01 {
+		width := serialization.DecodeShort(data, 6) // Width
+		height := serialization.DecodeShort(data, 8) // Height
+		depth := serialization.DecodeShort(data, 10) // Depth
 		
-		blockSize := 2 + 2 + 2 + 1 + serialization.STRING_LENGTH + serialization.HASH_LENGTH
-		headerSize := 5 + 1 + 2 + 2 + 2 + 2 + 2 + 2 + 1 + 1
+		spawnX := serialization.DecodeShort(data, 12) // Spawn X
+		spawnY := serialization.DecodeShort(data, 14) // Spawn Y
+		spawnZ := serialization.DecodeShort(data, 16) // Spawn Z
 		
-		//log.Println("DeserializeLevel(): Deserializing level header...")
+		return width, height, depth, Spawnpoint{spawnX, spawnY, spawnZ, data[18], data[19]}, levelHeaderSize(version), nil
+	}
+	
+	width := serialization.DecodeInt(data, 6) // Width
+	height := serialization.DecodeInt(data, 10) // Height
+	depth := serialization.DecodeInt(data, 14) // Depth
+	
+	spawnX := serialization.DecodeInt(data, 18) // Spawn X
+	spawnY := serialization.DecodeInt(data, 22) // Spawn Y
+	spawnZ := serialization.DecodeInt(data, 26) // Spawn Z
+	
+	return width, height, depth, Spawnpoint{spawnX, spawnY, spawnZ, data[30], data[31]}, levelHeaderSize(version), nil
+}
+
+func (level Level) Serialize() []byte {
+	if level.Type == LEVEL_TYPE_CHAIN {
+		blockSize := blockUpdateSize(LEVEL_FORMAT_VERSION)
 		
-		if data[5] != 0x01 {
-			log.Fatalln("Error: Invalid level format version! Please update goserver!")
+		buffer := level.serializeHeader("CHAIN", blockSize * len(level.Chain))
+		headerSize := len(buffer) - (blockSize * len(level.Chain))
+
+		for i := 0; i < len(level.Chain); i++ {
+			serialization.CopyData(headerSize + (blockSize * i), level.Chain[i].Serialize(), buffer) // Block
 		}
 		
-		width := serialization.DecodeShort(data, 6) // Width
-		height := serialization.DecodeShort(data, 6 + 2) // Height
-		depth := serialization.DecodeShort(data, 6 + 4) // Depth
+		return buffer
+	}
+	
+	buffer := level.serializeHeader("LEVEL", len(level.Data) + len(level.ExtendedData))
+	dataIndex := len(buffer) - len(level.Data) - len(level.ExtendedData)
+	
+	serialization.CopyData(dataIndex, level.Data, buffer)
+	serialization.CopyData(dataIndex + len(level.Data), level.ExtendedData, buffer)
+	
+	return buffer
+}
+
+// Deserializes a level file, messages about the level (like invalid metadata) are logged with the logger (nil logs to stderr)
+func DeserializeLevel(data []byte, logger *log.Logger) (Level, error) {
+	logger = levelLogger(logger)
+	
+	if len(data) < 6 {
+		return Level{}, ErrInvalidFormat
+	}
+	
+	if bytes.Equal(data[0:5], []byte("CHAIN")) {
+		//log.Println("DeserializeLevel(): Level type: Chain")
+		
+		blockSize := blockUpdateSize(data[5])
+		
+		//log.Println("DeserializeLevel(): Deserializing level header...")
 		
-		spawnX := serialization.DecodeShort(data, 6 + 6) // Spawn X
-		spawnY := serialization.DecodeShort(data, 6 + 8) // Spawn Y
-		spawnZ := serialization.DecodeShort(data, 6 + 10) // Spawn Z
+		width, height, depth, spawnpoint, headerSize, err := deserializeHeader(data)
 		
-		spawnYaw := data[6 + 12] // Spawn Yaw
-		spawnPitch := data[6 + 13] // Spawn Pitch
+		if err != nil {
+			return Level{}, err
+		}
 		
-		blockData := data[headerSize:]
+		if width <= 0 || height <= 0 || depth <= 0 {
+			return Level{}, ErrInvalidFormat
+		}
 		
 		level := Level{
 			width,
 			height,
 			depth,
 			make([]byte, width * height * depth),
-			Spawnpoint{spawnX, spawnY, spawnZ, spawnYaw, spawnPitch},
+			nil,
+			spawnpoint,
 			LEVEL_TYPE_CHAIN,
 			make([]BlockUpdate, 0),
+			hacks.AllowAll(),
+			permissions.AllowAll(),
+			DEFAULT_CLICK_DISTANCE,
+			make([]hotkeys.HotKey, 0),
+			DefaultEnvironment(),
+			createLevelCache(),
+			make(map[int]BlockUpdate),
 		}
 		
+		dataIndex, err := level.readMetadata(data, headerSize, logger)
+		
+		if err != nil {
+			return Level{}, err
+		}
+		
+		blockData := data[dataIndex:]
 		blocks := int(float32(len(blockData)) / float32(blockSize))
 		
 		//log.Println("DeserializeLevel(): Deserializing and Iterating block updates...")
@@ -214,74 +682,94 @@ func DeserializeLevel(data []byte) Level {
 		for i := 0; i < blocks; i++ {
 			startIndex := blockSize * i
 			endIndex := startIndex + blockSize
-			block := DeserializeBlockUpdate(blockData[startIndex:endIndex])
-			blockHash := sha256.Sum256(block.Serialize())
+			block := DeserializeBlockUpdate(blockData[startIndex:endIndex], data[5])
+			blockHash := block.Hash()
 			
 			if len(level.Chain) > 0 {
-				previousBlockHash := sha256.Sum256(level.Chain[len(level.Chain) - 1].Serialize())
+				previousBlockHash := level.Chain[len(level.Chain) - 1].Hash()
 				
 				if !bytes.Equal(block.PreviousBlock, previousBlockHash[:]) {
-					log.Fatalln("Block", blockHash, "contains an invalid previous block hash!")
+					return Level{}, fmt.Errorf("block %x contains an invalid previous block hash", blockHash)
 				}
 			}
 			
 			level.Chain = append(level.Chain, block)
 			
 			if level.IsOOB(block.X, block.Y, block.Z) {
-				log.Fatalln("Block", blockHash, "contains an invalid position!")
+				return Level{}, fmt.Errorf("block %x contains an invalid position", blockHash)
 			}
 			
-			level.Data[(block.Y * level.Depth + block.Z) * level.Width + block.X] = byte(block.ID)
+			level.setBlockAt(level.Index(block.X, block.Y, block.Z), block.ID)
+			level.lastUpdates[level.Index(block.X, block.Y, block.Z)] = block
 		}
 		
 		//log.Println("DeserializeLevel(): Finished!")
 		
-		return level
+		return level, nil
 	}
 	
 	if bytes.Equal(data[0:5], []byte("LEVEL")) {
-		headerSize := 5 + 1 + 2 + 2 + 2 + 2 + 2 + 2 + 1 + 1 // header bytes, byte (format version), short, short, short (Level Size), short, short, short (Spawnpoint Position), byte, byte (Spawnpoint Yaw & Pitch)
-		
 		//log.Println("DeserializeLevel(): Level type: Normal")
 		
 		//log.Println("DeserializeLevel(): Deserializing level header...")
 		
-		if data[5] != 0x01 {
-			log.Fatalln("Error: Invalid level format version! Please update goserver!")
-		}
-		
-		width := serialization.DecodeShort(data, 6) // Width
-		height := serialization.DecodeShort(data, 8) // Height
-		depth := serialization.DecodeShort(data, 10) // Depth
+		width, height, depth, spawnpoint, headerSize, err := deserializeHeader(data)
 		
-		spawnX := serialization.DecodeShort(data, 12) // Spawn X
-		spawnY := serialization.DecodeShort(data, 14) // Spawn Y
-		spawnZ := serialization.DecodeShort(data, 16) // Spawn Z
+		if err != nil {
+			return Level{}, err
+		}
 		
-		spawnYaw := data[18] // Spawn Yaw
-		spawnPitch := data[19] // Spawn Pitch
+		if width <= 0 || height <= 0 || depth <= 0 {
+			return Level{}, ErrInvalidFormat
+		}
 		
 		level := Level{
 			width,
 			height,
 			depth,
-			data[headerSize:],
-			Spawnpoint{spawnX, spawnY, spawnZ, spawnYaw, spawnPitch},
+			nil,
+			nil,
+			spawnpoint,
 			LEVEL_TYPE_NORMAL,
 			make([]BlockUpdate, 0),
+			hacks.AllowAll(),
+			permissions.AllowAll(),
+			DEFAULT_CLICK_DISTANCE,
+			make([]hotkeys.HotKey, 0),
+			DefaultEnvironment(),
+			createLevelCache(),
+			make(map[int]BlockUpdate),
+		}
+		
+		dataIndex, err := level.readMetadata(data, headerSize, logger)
+		
+		if err != nil {
+			return Level{}, err
+		}
+		
+		blockData := data[dataIndex:]
+		volume := width * height * depth
+		
+		if len(blockData) < volume {
+			return Level{}, ErrTruncatedLevel
+		}
+		
+		level.Data = blockData[:volume]
+		
+		if len(blockData) >= volume * 2 {
+			level.ExtendedData = blockData[volume:volume * 2]
 		}
 		
 		//log.Println("DeserializeLevel(): Finished!")
 		
-		return level
+		return level, nil
 	}
 	
-	log.Fatalln("Invalid level format!")
-	
-	return Level{16, 16, 16, make([]byte, 16 * 16 * 16), Spawnpoint{0, 0, 0, 0, 0}, LEVEL_TYPE_NORMAL, make([]BlockUpdate, 0)}
+	return Level{}, ErrInvalidFormat
 }
 
-func GenerateLevel(width int, height int, depth int, level_generation_type int, level_type int) Level {
+// Generates a new level, messages about the level (like the seed) are logged with the logger (nil logs to stderr)
+func GenerateLevel(width int, height int, depth int, level_generation_type int, level_type int, logger *log.Logger) Level {
 	//if level_type == LEVEL_TYPE_CHAIN {
 	//	panic("Chain levels are not implemented yet!")
 	//}
@@ -291,9 +779,17 @@ func GenerateLevel(width int, height int, depth int, level_generation_type int,
 		height,
 		depth,
 		make([]byte, width * height * depth),
+		nil,
 		Spawnpoint{int(float32(width) / 2.0), 0, int(float32(depth) / 2.0), 0, 0},
 		level_type,
 		make([]BlockUpdate, 0),
+		hacks.AllowAll(),
+		permissions.AllowAll(),
+		DEFAULT_CLICK_DISTANCE,
+		make([]hotkeys.HotKey, 0),
+		DefaultEnvironment(),
+		createLevelCache(),
+		make(map[int]BlockUpdate),
 	}
 	
 	if level_generation_type == LEVEL_FLAT {
@@ -301,7 +797,7 @@ func GenerateLevel(width int, height int, depth int, level_generation_type int,
 	}
 	
 	if level_generation_type == LEVEL_EXPERIMENTAL {
-		ExperimentalLevelGenerator(&level)
+		ExperimentalLevelGenerator(&level, levelLogger(logger))
 	}
 	
 	for y := 0; y < height; y++ {
@@ -338,10 +834,10 @@ func FlatLevelGenerator(level *Level) {
 	}
 }
 
-func ExperimentalLevelGenerator(level *Level) {
+func ExperimentalLevelGenerator(level *Level, logger *log.Logger) {
 	seed := time.Now().UnixNano()
 	
-	log.Println("Level seed:", seed)
+	logger.Println("Level seed:", seed)
 	
 	heightNoise1 := perlin.NewPerlin(2., 2., 3, int64(seed + 0))
 	heightNoise2 := perlin.NewPerlin(2., 2., 3, int64(seed + 1))
@@ -0,0 +1,123 @@
+package level
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestDeserializeNormalLevel(t *testing.T) {
+	level := GenerateLevel(16, 16, 16, LEVEL_FLAT, LEVEL_TYPE_NORMAL, nil)
+	level.SetBlock(3, 10, 4, 300)
+	level.ClickDistance = 320
+
+	loaded, err := DeserializeLevel(level.Serialize(), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.GetBlock(3, 10, 4) != 300 || loaded.GetBlock(0, 0, 0) != level.GetBlock(0, 0, 0) || loaded.ClickDistance != 320 {
+		t.Fatal("the loaded level is different from the saved level")
+	}
+}
+
+func TestDeserializeChainLevel(t *testing.T) {
+	level := GenerateLevel(16, 16, 16, LEVEL_FLAT, LEVEL_TYPE_CHAIN, nil)
+	level.SetBlockPlayer(1, 10, 1, 1, "alice")
+	level.SetBlockPlayer(2, 10, 2, 2, "bob")
+
+	loaded, err := DeserializeLevel(level.Serialize(), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(loaded.Chain) != len(level.Chain) || loaded.GetBlock(2, 10, 2) != 2 || loaded.Chain[len(loaded.Chain) - 1].Name != "bob" {
+		t.Fatal("the loaded chain is different from the saved chain")
+	}
+
+	// Changing a block in the middle of the chain breaks the hash of the next block
+	level.Chain[len(level.Chain) - 2].ID = 3
+
+	if _, err := DeserializeLevel(level.Serialize(), nil); err == nil || !strings.Contains(err.Error(), "previous block hash") {
+		t.Fatalf("err = %v; want an invalid previous block hash", err)
+	}
+}
+
+func TestLastBlockUpdate(t *testing.T) {
+	for _, levelType := range []int{LEVEL_TYPE_NORMAL, LEVEL_TYPE_CHAIN} {
+		level := GenerateLevel(16, 16, 16, LEVEL_FLAT, levelType, nil)
+		level.SetBlockPlayer(1, 10, 1, 1, "alice")
+		level.SetBlockPlayer(2, 10, 2, 2, "bob")
+		level.SetBlockPlayer(1, 10, 1, 3, "carol")
+
+		if update, exists := level.LastBlockUpdate(1, 10, 1); !exists || update.Name != "carol" || update.ID != 3 {
+			t.Errorf("level type %d: last update at 1, 10, 1 = %v, %v; want carol", levelType, update, exists)
+		}
+
+		if _, exists := level.LastBlockUpdate(3, 10, 3); exists {
+			t.Errorf("level type %d: an unchanged block has a last update", levelType)
+		}
+
+		if _, exists := level.LastBlockUpdate(-1, 10, 3); exists {
+			t.Errorf("level type %d: a position outside of the level has a last update", levelType)
+		}
+	}
+
+	// Chain levels keep their block updates when they are loaded
+	level := GenerateLevel(16, 16, 16, LEVEL_FLAT, LEVEL_TYPE_CHAIN, nil)
+	level.SetBlockPlayer(1, 10, 1, 1, "alice")
+	level.SetBlockPlayer(1, 10, 1, 2, "bob")
+
+	loaded, err := DeserializeLevel(level.Serialize(), nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if update, exists := loaded.LastBlockUpdate(1, 10, 1); !exists || update.Name != "bob" {
+		t.Fatalf("last update of the loaded level = %v, %v; want bob", update, exists)
+	}
+}
+
+func TestDeserializeInvalidLevel(t *testing.T) {
+	data := GenerateLevel(16, 16, 16, LEVEL_FLAT, LEVEL_TYPE_NORMAL, nil).Serialize()
+
+	tests := map[string]struct {
+		data []byte
+		err error
+	}{
+		"empty": {nil, ErrInvalidFormat},
+		"unknown header": {append([]byte("OTHER"), data[5:]...), ErrInvalidFormat},
+		"newer version": {append(append([]byte("LEVEL"), LEVEL_FORMAT_VERSION + 1), data[6:]...), ErrUnsupportedVersion},
+		"version 0": {append(append([]byte("LEVEL"), 0x00), data[6:]...), ErrUnsupportedVersion},
+		"truncated header": {data[:20], ErrTruncatedLevel},
+		"truncated metadata": {data[:levelHeaderSize(LEVEL_FORMAT_VERSION) + 10], ErrTruncatedLevel},
+		"truncated blocks": {data[:len(data) - 1], ErrTruncatedLevel},
+	}
+
+	for name, test := range tests {
+		if _, err := DeserializeLevel(test.data, nil); err != test.err {
+			t.Errorf("%s: err = %v; want %v", name, err, test.err)
+		}
+	}
+}
+
+func TestMetadataLogger(t *testing.T) {
+	level := GenerateLevel(16, 16, 16, LEVEL_FLAT, LEVEL_TYPE_NORMAL, nil)
+
+	var output bytes.Buffer
+
+	// Invalid metadata is skipped, and logged with the logger that is passed in
+	level.deserializeMetadata([]byte("unknown=1\nenv.sky=nonsense\nclickdistance=320"), log.New(&output, "", 0))
+
+	if level.ClickDistance != 320 {
+		t.Fatal("valid metadata after invalid metadata was not read")
+	}
+
+	if !strings.Contains(output.String(), "Unknown level metadata: unknown") || !strings.Contains(output.String(), "Invalid level metadata: env.sky") {
+		t.Fatalf("unexpected log output %q", output.String())
+	}
+}
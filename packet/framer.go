@@ -0,0 +1,45 @@
+package packet
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+var ErrUnknownPacket = errors.New("unknown packet ID")
+
+// PacketFramer splits a byte stream into whole packets.
+// TCP does not keep packet boundaries, so a single read can contain several packets (or only part of one).
+type PacketFramer struct {
+	Reader  *bufio.Reader
+	Lengths map[byte]int // Packet ID -> packet length (including the packet ID)
+}
+
+func (f *PacketFramer) ReadPacket() ([]byte, error) {
+	packetID, err := f.Reader.ReadByte()
+
+	if err != nil {
+		return nil, err
+	}
+
+	length, exists := f.Lengths[packetID]
+
+	if !exists {
+		return nil, ErrUnknownPacket
+	}
+
+	buffer := make([]byte, length)
+	buffer[0] = packetID
+
+	_, err = io.ReadFull(f.Reader, buffer[1:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer, nil
+}
+
+func CreatePacketFramer(source io.Reader, lengths map[byte]int) PacketFramer {
+	return PacketFramer{bufio.NewReader(source), lengths}
+}
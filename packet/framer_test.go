@@ -0,0 +1,95 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+var testLengths = map[byte]int{
+	0x05: 9,
+	0x08: 10,
+	0x0d: 66,
+}
+
+func testSetBlock() []byte {
+	return []byte{0x05, 0x00, 0x01, 0x00, 0x02, 0x00, 0x03, 0x01, 0x01}
+}
+
+func testPosition() []byte {
+	return []byte{0x08, 0xff, 0x00, 0x20, 0x00, 0x40, 0x00, 0x60, 0x10, 0x20}
+}
+
+func TestReadPacketCoalesced(t *testing.T) {
+	stream := append(testSetBlock(), testPosition()...)
+	framer := CreatePacketFramer(bytes.NewReader(stream), testLengths)
+
+	first, err := framer.ReadPacket()
+
+	if err != nil || !bytes.Equal(first, testSetBlock()) {
+		t.Fatalf("first packet = %x, %v; want %x", first, err, testSetBlock())
+	}
+
+	second, err := framer.ReadPacket()
+
+	if err != nil || !bytes.Equal(second, testPosition()) {
+		t.Fatalf("second packet = %x, %v; want %x", second, err, testPosition())
+	}
+
+	if _, err := framer.ReadPacket(); err != io.EOF {
+		t.Fatalf("read after the last packet: %v; want EOF", err)
+	}
+}
+
+func TestReadPacketSplit(t *testing.T) {
+	stream := append(testPosition(), testSetBlock()...)
+	framer := CreatePacketFramer(iotest.OneByteReader(bytes.NewReader(stream)), testLengths)
+
+	first, err := framer.ReadPacket()
+
+	if err != nil || !bytes.Equal(first, testPosition()) {
+		t.Fatalf("first packet = %x, %v; want %x", first, err, testPosition())
+	}
+
+	second, err := framer.ReadPacket()
+
+	if err != nil || !bytes.Equal(second, testSetBlock()) {
+		t.Fatalf("second packet = %x, %v; want %x", second, err, testSetBlock())
+	}
+}
+
+func TestReadPacketUnknownID(t *testing.T) {
+	framer := CreatePacketFramer(bytes.NewReader([]byte{0x42, 0x00, 0x00}), testLengths)
+
+	if _, err := framer.ReadPacket(); !errors.Is(err, ErrUnknownPacket) {
+		t.Fatalf("err = %v; want ErrUnknownPacket", err)
+	}
+}
+
+func TestReadPacketTruncated(t *testing.T) {
+	framer := CreatePacketFramer(bytes.NewReader(testSetBlock()[:5]), testLengths)
+
+	if _, err := framer.ReadPacket(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("err = %v; want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReadPacketLengthChange(t *testing.T) {
+	// Extensions change packet lengths after negotiation, and the framer has to use the new length for the next packet
+	lengths := map[byte]int{0x05: 9}
+	stream := append(testSetBlock(), append(testSetBlock(), 0x00)...)
+	framer := CreatePacketFramer(bytes.NewReader(stream), lengths)
+
+	if _, err := framer.ReadPacket(); err != nil {
+		t.Fatal(err)
+	}
+
+	lengths[0x05] = 10
+	packet, err := framer.ReadPacket()
+
+	if err != nil || len(packet) != 10 {
+		t.Fatalf("packet = %x, %v; want 10 bytes", packet, err)
+	}
+}
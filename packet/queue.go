@@ -0,0 +1,120 @@
+package packet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrQueueFull = errors.New("send queue is full")
+var ErrQueueClosed = errors.New("send queue is closed")
+
+// QueuedConn sends everything that is written to it from a bounded queue in its own goroutine,
+// so that writing to a slow client never blocks the goroutine that writes to it.
+// The connection is closed if the queue overflows, or if a write takes longer than the write timeout.
+type QueuedConn struct {
+	net.Conn
+	queue chan []byte
+	closing chan struct{} // Closed when the connection should be closed once the queue has been sent
+	closeOnce sync.Once
+	writeTimeout time.Duration
+	overflowed int32
+}
+
+func (c *QueuedConn) Write(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	// The buffer of the packet writer is reused, so the queue gets a copy
+	buffer := make([]byte, len(data))
+	copy(buffer, data)
+
+	select {
+	case <-c.closing:
+		return 0, ErrQueueClosed
+	default:
+	}
+
+	select {
+	case c.queue <- buffer:
+		return len(data), nil
+	default:
+		atomic.StoreInt32(&c.overflowed, 1)
+		c.Conn.Close()
+		c.Close()
+		return 0, ErrQueueFull
+	}
+}
+
+// Sends the data that is still in the queue, and then closes the connection
+func (c *QueuedConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+	})
+
+	return nil
+}
+
+// Returns whether Close has been called (the rest of the queue may still be sending)
+func (c *QueuedConn) Closed() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns whether the connection was closed because the queue overflowed
+func (c *QueuedConn) Overflowed() bool {
+	return atomic.LoadInt32(&c.overflowed) != 0
+}
+
+func (c *QueuedConn) send(data []byte) bool {
+	c.Conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	_, err := c.Conn.Write(data)
+
+	return err == nil
+}
+
+func (c *QueuedConn) writeThread() {
+	defer c.Conn.Close()
+
+	for {
+		select {
+		case data := <-c.queue:
+			if !c.send(data) {
+				c.Close()
+				return
+			}
+		case <-c.closing:
+			for {
+				select {
+				case data := <-c.queue:
+					if !c.send(data) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// Starts the goroutine that sends the queue. size is the number of writes that can be queued.
+func CreateQueuedConn(conn net.Conn, size int, writeTimeout time.Duration) *QueuedConn {
+	c := &QueuedConn{
+		Conn: conn,
+		queue: make(chan []byte, size),
+		closing: make(chan struct{}),
+		writeTimeout: writeTimeout,
+	}
+
+	go c.writeThread()
+
+	return c
+}
@@ -0,0 +1,142 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A connection whose writes block until it is closed
+type stalledConn struct {
+	net.Conn
+	closed chan struct{}
+	closeOnce sync.Once
+}
+
+func createStalledConn() *stalledConn {
+	return &stalledConn{closed: make(chan struct{})}
+}
+
+func (c *stalledConn) Write(data []byte) (int, error) {
+	<-c.closed
+	return 0, errors.New("connection closed")
+}
+
+func (c *stalledConn) SetWriteDeadline(deadline time.Time) error {
+	return nil
+}
+
+func (c *stalledConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+
+	return nil
+}
+
+func TestQueueOverflow(t *testing.T) {
+	conn := createStalledConn()
+	queue := CreateQueuedConn(conn, 2, time.Minute)
+
+	// One write is taken by the write goroutine (which is stuck), the next ones fill the queue
+	var err error
+
+	for i := 0; i < 10 && err == nil; i++ {
+		_, err = queue.Write([]byte{byte(i)})
+	}
+
+	if err != ErrQueueFull {
+		t.Fatalf("err = %v; want ErrQueueFull", err)
+	}
+
+	if !queue.Overflowed() || !queue.Closed() {
+		t.Fatal("the queue isn't marked as overflowed and closed")
+	}
+
+	select {
+	case <-conn.closed:
+	case <-time.After(time.Second):
+		t.Fatal("the connection wasn't closed")
+	}
+}
+
+func TestQueueWriteTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	// Nothing reads from the client, so the write times out
+	queue := CreateQueuedConn(server, 16, time.Millisecond * 50)
+
+	if _, err := queue.Write([]byte("stalled")); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second * 2)
+
+	for !queue.Closed() {
+		if time.Now().After(deadline) {
+			t.Fatal("the stalled connection wasn't closed")
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// The connection itself is closed once the write goroutine stops
+	client.SetReadDeadline(time.Now().Add(time.Second * 2))
+
+	if _, err := client.Read(make([]byte, 16)); err == nil {
+		t.Fatal("read from an evicted connection succeeded")
+	}
+
+	if queue.Overflowed() {
+		t.Fatal("a timeout is reported as an overflow")
+	}
+}
+
+func TestQueueCloseDrains(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	queue := CreateQueuedConn(server, 16, time.Second * 5)
+	expected := []byte{}
+
+	for i := 0; i < 5; i++ {
+		data := bytes.Repeat([]byte{byte(i)}, 100)
+		expected = append(expected, data...)
+
+		if _, err := queue.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue.Close()
+
+	// Everything that was queued before Close arrives before the connection is closed
+	client.SetReadDeadline(time.Now().Add(time.Second * 5))
+	received, err := ioutil.ReadAll(client)
+
+	if err != nil || !bytes.Equal(received, expected) {
+		t.Fatalf("received %d bytes (%v); want %d", len(received), err, len(expected))
+	}
+}
+
+func TestQueueWriteAfterClose(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	queue := CreateQueuedConn(server, 16, time.Second)
+	queue.Close()
+
+	if _, err := queue.Write([]byte{0x01}); err != ErrQueueClosed {
+		t.Fatalf("err = %v; want ErrQueueClosed", err)
+	}
+
+	// Empty writes are ignored
+	if n, err := queue.Write(nil); n != 0 || err != nil {
+		t.Fatalf("empty write = %d, %v", n, err)
+	}
+}
@@ -35,8 +35,13 @@ func (r *PacketReader) ReadString() string {
 	return serialization.DecodeString(bytes.ReplaceAll(r.ReadBytes(serialization.STRING_LENGTH), []byte{0}, []byte{0x20}), 0)
 }
 
+// Shorts in packets are signed
 func (r *PacketReader) ReadShort() int {
-	return serialization.DecodeShort(r.ReadBytes(2), 0)
+	return int(int16(serialization.DecodeShort(r.ReadBytes(2), 0)))
+}
+
+func (r *PacketReader) ReadInt() int {
+	return serialization.DecodeInt(r.ReadBytes(4), 0)
 }
 
 func (r *PacketReader) ReadByte() byte {
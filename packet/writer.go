@@ -21,6 +21,10 @@ func (w *PacketWriter) WriteShort(data int) {
 	w.WriteBytes(serialization.EncodeShort(data))
 }
 
+func (w *PacketWriter) WriteInt(data int) {
+	w.WriteBytes(serialization.EncodeInt(data))
+}
+
 func (w *PacketWriter) WriteByte(data byte) {
 	w.WriteBytes([]byte{data})
 }
@@ -0,0 +1,108 @@
+package permissions
+
+import (
+	"goserver/blocks"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Blocks that players are not allowed to place or break (CPE BlockPermissions, and enforced by the server)
+type Permissions struct {
+	DeniedPlace map[uint16]bool
+	DeniedBreak map[uint16]bool
+}
+
+func AllowAll() Permissions {
+	return Permissions{make(map[uint16]bool), make(map[uint16]bool)}
+}
+
+func CreatePermissions(deniedPlace []uint16, deniedBreak []uint16) Permissions {
+	permissions := AllowAll()
+
+	for _, id := range deniedPlace {
+		permissions.DeniedPlace[id] = true
+	}
+
+	for _, id := range deniedBreak {
+		permissions.DeniedBreak[id] = true
+	}
+
+	return permissions
+}
+
+func (permissions Permissions) CanPlace(id uint16) bool {
+	return !permissions.DeniedPlace[id]
+}
+
+func (permissions Permissions) CanBreak(id uint16) bool {
+	return !permissions.DeniedBreak[id]
+}
+
+// Returns the denied blocks for "place" or "break" (or nil if the action doesn't exist)
+func (permissions Permissions) Get(action string) map[uint16]bool {
+	switch action {
+	case "place":
+		return permissions.DeniedPlace
+	case "break":
+		return permissions.DeniedBreak
+	}
+
+	return nil
+}
+
+// Blocks are only allowed if both sets allow them
+func (permissions Permissions) And(other Permissions) Permissions {
+	combined := AllowAll()
+
+	for _, set := range []Permissions{permissions, other} {
+		for id := range set.DeniedPlace {
+			combined.DeniedPlace[id] = true
+		}
+
+		for id := range set.DeniedBreak {
+			combined.DeniedBreak[id] = true
+		}
+	}
+
+	return combined
+}
+
+// Formats a set of blocks as a sorted, comma separated list of block IDs
+func FormatBlocks(set map[uint16]bool) string {
+	ids := make([]int, 0, len(set))
+
+	for id := range set {
+		ids = append(ids, int(id))
+	}
+
+	sort.Ints(ids)
+
+	values := make([]string, len(ids))
+
+	for i, id := range ids {
+		values[i] = strconv.Itoa(id)
+	}
+
+	return strings.Join(values, ",")
+}
+
+func ParseBlocks(value string) (map[uint16]bool, bool) {
+	set := make(map[uint16]bool)
+
+	if len(value) == 0 {
+		return set, true
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		id, err := strconv.ParseUint(item, 10, 16)
+
+		if err != nil || id > blocks.BLOCK_MAX_EXTENDED {
+			return nil, false
+		}
+
+		set[uint16(id)] = true
+	}
+
+	return set, true
+}
@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"goserver/serialization"
+	"strings"
+)
+
+func isColorCode(character byte) bool {
+	return (character >= '0' && character <= '9') || (character >= 'a' && character <= 'f') || (character >= 'A' && character <= 'F')
+}
+
+// Returns the last color code in the message (or a blank string if there isn't one)
+func LastColorCode(message string) string {
+	for i := len(message) - 2; i >= 0; i-- {
+		if message[i] == '&' && isColorCode(message[i + 1]) {
+			return message[i:i + 2]
+		}
+	}
+
+	return ""
+}
+
+// Splits a message into lines that fit into a single message packet.
+// Lines are split between words where possible, and each line starts with the color that the previous line ended with.
+func WrapMessage(message string) []string {
+	lines := make([]string, 0)
+	color := ""
+
+	for len(color) + len(message) > serialization.STRING_LENGTH {
+		length := serialization.STRING_LENGTH - len(color)
+		split := length
+
+		if message[length] != ' ' {
+			space := strings.LastIndex(message[:length], " ")
+
+			if space > 0 {
+				split = space
+			}
+		}
+
+		// Don't split color codes
+
+		if message[split - 1] == '&' {
+			split--
+		}
+
+		// Lines can't be empty, so without a usable break point the message is split at the length limit
+
+		if split < 1 {
+			split = length
+
+			if message[split - 1] == '&' {
+				split--
+			}
+		}
+
+		line := color + message[:split]
+		lines = append(lines, line)
+
+		if lastColor := LastColorCode(line); lastColor != "" {
+			color = lastColor
+		}
+
+		message = strings.TrimLeft(message[split:], " ")
+	}
+
+	if len(message) != 0 || len(lines) == 0 {
+		lines = append(lines, color + message)
+	}
+
+	return lines
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"goserver/serialization"
+	"strings"
+	"testing"
+)
+
+func checkLines(t *testing.T, lines []string) {
+	for i, line := range lines {
+		if len(line) == 0 || len(line) > serialization.STRING_LENGTH {
+			t.Errorf("line %d has length %d: %q", i, len(line), line)
+		}
+	}
+}
+
+func TestWrapMessageShort(t *testing.T) {
+	lines := WrapMessage("Bob: hello")
+
+	if len(lines) != 1 || lines[0] != "Bob: hello" {
+		t.Fatalf("lines = %q", lines)
+	}
+}
+
+func TestWrapMessageSplitsBetweenWords(t *testing.T) {
+	message := "Bob: " + strings.Repeat("word ", 20)
+	lines := WrapMessage(message)
+
+	checkLines(t, lines)
+
+	for i, line := range lines {
+		if strings.HasPrefix(line, " ") || strings.HasSuffix(line, "wor") {
+			t.Errorf("line %d is split inside a word: %q", i, line)
+		}
+	}
+}
+
+func TestWrapMessageLongWord(t *testing.T) {
+	lines := WrapMessage(strings.Repeat("a", 200))
+
+	checkLines(t, lines)
+
+	if len(lines) != 4 || strings.Join(lines, "") != strings.Repeat("a", 200) {
+		t.Fatalf("lines = %q", lines)
+	}
+}
+
+func TestWrapMessageColorCodeAtBoundary(t *testing.T) {
+	// The color code starts at the last character of the first line
+	message := strings.Repeat("a", serialization.STRING_LENGTH - 1) + "&cred"
+	lines := WrapMessage(message)
+
+	checkLines(t, lines)
+
+	if len(lines) != 2 || strings.HasSuffix(lines[0], "&") || lines[1] != "&cred" {
+		t.Fatalf("lines = %q", lines)
+	}
+}
+
+func TestWrapMessageContinuesColor(t *testing.T) {
+	lines := WrapMessage("&a" + strings.Repeat("green ", 20))
+
+	checkLines(t, lines)
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "&a") {
+			t.Errorf("line %d does not start with the color: %q", i, line)
+		}
+	}
+}
+
+func TestWrapMessageAmpersandBeforeSpace(t *testing.T) {
+	// The only break point is right after an "&", which used to split at 0 and never finish
+	message := "Bob: " + strings.Repeat("b", 59) + "& " + strings.Repeat("c", 80)
+	lines := WrapMessage(message)
+
+	checkLines(t, lines)
+
+	if len(lines) > 5 {
+		t.Fatalf("too many lines: %q", lines)
+	}
+
+	if joined := strings.Join(lines, ""); strings.Count(joined, "c") != 80 || strings.Count(joined, "b") != 60 {
+		t.Fatalf("lines lost characters: %q", lines)
+	}
+}
@@ -0,0 +1,436 @@
+package protocol
+
+import (
+	"goserver/blocks"
+	"goserver/hacks"
+	"goserver/packet"
+)
+
+// Classic Protocol Extension (CPE)
+// https://wiki.vg/Classic_Protocol_Extension
+
+const (
+	// CPE constants
+
+	CPE_MAGIC = 0x42 // Sent in the unused byte of the client identification packet by clients that support CPE
+	CPE_APP_NAME = "goserver"
+	CUSTOM_BLOCKS_SUPPORT_LEVEL = 1
+	CLIENT_POSITION_AND_ORIENTATION_EXT_LENGTH = 16 // Length of the position packet with ExtEntityPositions
+	CLIENT_SET_BLOCK_EXT_LENGTH = 10 // Length of the set block packet with ExtendedBlocks
+	HOTBAR_SIZE = 9
+	BULK_BLOCK_UPDATE_SIZE = 256 // Maximum number of blocks in a BulkBlockUpdate packet
+
+	// Extension names
+
+	EXT_CUSTOM_BLOCKS = "CustomBlocks"
+	EXT_BLOCK_DEFINITIONS = "BlockDefinitions"
+	EXT_BLOCK_DEFINITIONS_EXT = "BlockDefinitionsExt"
+	EXT_PLAYER_LIST = "ExtPlayerList"
+	EXT_MESSAGE_TYPES = "MessageTypes"
+	EXT_LONGER_MESSAGES = "LongerMessages"
+	EXT_FAST_MAP = "FastMap"
+	EXT_ENTITY_POSITIONS = "ExtEntityPositions"
+	EXT_SET_SPAWNPOINT = "SetSpawnpoint"
+	EXT_TWO_WAY_PING = "TwoWayPing"
+	EXT_PLAYER_CLICK = "PlayerClick"
+	EXT_BULK_BLOCK_UPDATE = "BulkBlockUpdate"
+	EXT_HACK_CONTROL = "HackControl"
+	EXT_ENV_COLORS = "EnvColors"
+	EXT_ENV_MAP_ASPECT = "EnvMapAspect"
+	EXT_ENV_WEATHER_TYPE = "EnvWeatherType"
+	EXT_SELECTION_CUBOID = "SelectionCuboid"
+	EXT_CHANGE_MODEL = "ChangeModel"
+	EXT_EXTENDED_BLOCKS = "ExtendedBlocks"
+	EXT_BLOCK_PERMISSIONS = "BlockPermissions"
+	EXT_INVENTORY_ORDER = "InventoryOrder"
+	EXT_SET_HOTBAR = "SetHotbar"
+	EXT_CLICK_DISTANCE = "ClickDistance"
+	EXT_TEXT_HOT_KEY = "TextHotKey"
+
+	// TwoWayPing directions
+
+	PING_FROM_CLIENT = 0
+	PING_FROM_SERVER = 1
+
+	// PlayerClick buttons and actions
+
+	CLICK_BUTTON_LEFT = 0
+	CLICK_BUTTON_RIGHT = 1
+	CLICK_BUTTON_MIDDLE = 2
+	CLICK_ACTION_PRESS = 0
+	CLICK_ACTION_RELEASE = 1
+
+	// EnvColors variables
+
+	ENV_COLOR_SKY = 0
+	ENV_COLOR_CLOUD = 1
+	ENV_COLOR_FOG = 2
+	ENV_COLOR_AMBIENT = 3
+	ENV_COLOR_DIFFUSE = 4
+
+	// EnvMapAspect properties
+
+	ENV_PROPERTY_SIDE_BLOCK = 0
+	ENV_PROPERTY_EDGE_BLOCK = 1
+	ENV_PROPERTY_EDGE_HEIGHT = 2
+	ENV_PROPERTY_CLOUDS_HEIGHT = 3
+
+	// Message types (MessageTypes)
+
+	MESSAGE_TYPE_CHAT = 0
+	MESSAGE_TYPE_STATUS_1 = 1
+	MESSAGE_TYPE_STATUS_2 = 2
+	MESSAGE_TYPE_STATUS_3 = 3
+	MESSAGE_TYPE_BOTTOM_RIGHT_1 = 11
+	MESSAGE_TYPE_BOTTOM_RIGHT_2 = 12
+	MESSAGE_TYPE_BOTTOM_RIGHT_3 = 13
+	MESSAGE_TYPE_ANNOUNCEMENT = 100
+	MESSAGE_TYPE_BIG_ANNOUNCEMENT = 101
+	MESSAGE_TYPE_SMALL_ANNOUNCEMENT = 102
+
+	// Client -> Server
+
+	CLIENT_EXT_INFO = 0x10
+	CLIENT_EXT_ENTRY = 0x11
+	CLIENT_CUSTOM_BLOCK_SUPPORT_LEVEL = 0x13
+	CLIENT_PLAYER_CLICK = 0x22
+	CLIENT_TWO_WAY_PING = 0x2b
+
+	// Server -> Client
+
+	SERVER_EXT_INFO = 0x10
+	SERVER_EXT_ENTRY = 0x11
+	SERVER_CUSTOM_BLOCK_SUPPORT_LEVEL = 0x13
+	SERVER_CLICK_DISTANCE = 0x12
+	SERVER_SET_TEXT_HOT_KEY = 0x15
+	SERVER_EXT_ADD_PLAYER_NAME = 0x16
+	SERVER_EXT_REMOVE_PLAYER_NAME = 0x18
+	SERVER_HACK_CONTROL = 0x20
+	SERVER_EXT_ADD_ENTITY_2 = 0x21
+	SERVER_ENV_COLORS = 0x19
+	SERVER_MAKE_SELECTION = 0x1a
+	SERVER_REMOVE_SELECTION = 0x1b
+	SERVER_SET_BLOCK_PERMISSION = 0x1c
+	SERVER_CHANGE_MODEL = 0x1d
+	SERVER_ENV_WEATHER_TYPE = 0x1f
+	SERVER_DEFINE_BLOCK = 0x23
+	SERVER_REMOVE_BLOCK_DEFINITION = 0x24
+	SERVER_DEFINE_BLOCK_EXT = 0x25
+	SERVER_BULK_BLOCK_UPDATE = 0x26
+	SERVER_SET_MAP_ENV_URL = 0x28
+	SERVER_SET_MAP_ENV_PROPERTY = 0x29
+	SERVER_TWO_WAY_PING = 0x2b
+	SERVER_SET_INVENTORY_ORDER = 0x2c
+	SERVER_SET_HOTBAR = 0x2d
+	SERVER_SET_SPAWNPOINT = 0x2e
+)
+
+type Extension struct {
+	Name string
+	Version int
+}
+
+// Extensions supported by the server
+
+var SERVER_EXTENSIONS = []Extension{
+	{EXT_CUSTOM_BLOCKS, 1},
+	{EXT_BLOCK_DEFINITIONS, 1},
+	{EXT_BLOCK_DEFINITIONS_EXT, 2},
+	{EXT_PLAYER_LIST, 2},
+	{EXT_MESSAGE_TYPES, 1},
+	{EXT_LONGER_MESSAGES, 1},
+	{EXT_FAST_MAP, 1},
+	{EXT_ENTITY_POSITIONS, 1},
+	{EXT_SET_SPAWNPOINT, 1},
+	{EXT_TWO_WAY_PING, 1},
+	{EXT_PLAYER_CLICK, 1},
+	{EXT_BULK_BLOCK_UPDATE, 1},
+	{EXT_HACK_CONTROL, 1},
+	{EXT_ENV_COLORS, 1},
+	{EXT_ENV_MAP_ASPECT, 1},
+	{EXT_ENV_WEATHER_TYPE, 1},
+	{EXT_SELECTION_CUBOID, 1},
+	{EXT_CHANGE_MODEL, 1},
+	{EXT_EXTENDED_BLOCKS, 1},
+	{EXT_BLOCK_PERMISSIONS, 1},
+	{EXT_INVENTORY_ORDER, 1},
+	{EXT_SET_HOTBAR, 1},
+	{EXT_CLICK_DISTANCE, 1},
+	{EXT_TEXT_HOT_KEY, 1},
+}
+
+func ServerExtensionVersion(name string) int {
+	for _, extension := range SERVER_EXTENSIONS {
+		if extension.Name == name {
+			return extension.Version
+		}
+	}
+
+	return 0
+}
+
+// Packets
+
+func WriteExtInfo(w *packet.PacketWriter, appName string, extensionCount int) {
+	w.WriteByte(SERVER_EXT_INFO) // Packet ID
+	w.WriteString(appName) // App Name
+	w.WriteShort(extensionCount) // Extension Count
+}
+
+func WriteExtEntry(w *packet.PacketWriter, name string, version int) {
+	w.WriteByte(SERVER_EXT_ENTRY) // Packet ID
+	w.WriteString(name) // Extension Name
+	w.WriteInt(version) // Version
+}
+
+func WriteCustomBlockSupportLevel(w *packet.PacketWriter, level byte) {
+	w.WriteByte(SERVER_CUSTOM_BLOCK_SUPPORT_LEVEL) // Packet ID
+	w.WriteByte(level) // Support Level
+}
+
+func writeBool(w *packet.PacketWriter, value bool) {
+	if value {
+		w.WriteByte(0x01)
+	} else {
+		w.WriteByte(0x00)
+	}
+}
+
+// Block IDs are shorts for clients that support ExtendedBlocks
+func writeBlock(w *packet.PacketWriter, id uint16, extBlocks bool) {
+	if extBlocks {
+		w.WriteShort(int(id))
+	} else {
+		w.WriteByte(byte(id))
+	}
+}
+
+func WriteDefineBlock(w *packet.PacketWriter, definition blocks.BlockDefinition, extBlocks bool) {
+	w.WriteByte(SERVER_DEFINE_BLOCK) // Packet ID
+	writeBlock(w, definition.ID, extBlocks) // Block ID
+	w.WriteString(definition.Name) // Name
+	w.WriteByte(definition.Solidity) // Solidity
+	w.WriteByte(definition.MovementSpeed) // Movement Speed
+	w.WriteByte(definition.TopTexture) // Top Texture ID
+	w.WriteByte(definition.LeftTexture) // Side Texture ID
+	w.WriteByte(definition.BottomTexture) // Bottom Texture ID
+	writeBool(w, definition.TransmitsLight) // Transmit Light
+	w.WriteByte(definition.WalkSound) // Walk Sound
+	writeBool(w, definition.FullBright) // Full Bright
+
+	if definition.Sprite {
+		w.WriteByte(0) // Shape (sprite)
+	} else {
+		w.WriteByte(definition.MaxY) // Shape (height)
+	}
+
+	w.WriteByte(definition.BlockDraw) // Block Draw
+	w.WriteByte(definition.FogDensity) // Fog Density
+	w.WriteByte(definition.FogR) // Fog R
+	w.WriteByte(definition.FogG) // Fog G
+	w.WriteByte(definition.FogB) // Fog B
+}
+
+func WriteDefineBlockExt(w *packet.PacketWriter, definition blocks.BlockDefinition, extBlocks bool) {
+	w.WriteByte(SERVER_DEFINE_BLOCK_EXT) // Packet ID
+	writeBlock(w, definition.ID, extBlocks) // Block ID
+	w.WriteString(definition.Name) // Name
+	w.WriteByte(definition.Solidity) // Solidity
+	w.WriteByte(definition.MovementSpeed) // Movement Speed
+	w.WriteByte(definition.TopTexture) // Top Texture ID
+	w.WriteByte(definition.LeftTexture) // Left Texture ID
+	w.WriteByte(definition.RightTexture) // Right Texture ID
+	w.WriteByte(definition.FrontTexture) // Front Texture ID
+	w.WriteByte(definition.BackTexture) // Back Texture ID
+	w.WriteByte(definition.BottomTexture) // Bottom Texture ID
+	writeBool(w, definition.TransmitsLight) // Transmit Light
+	w.WriteByte(definition.WalkSound) // Walk Sound
+	writeBool(w, definition.FullBright) // Full Bright
+	w.WriteByte(definition.MinX) // Min X
+	w.WriteByte(definition.MinY) // Min Y
+	w.WriteByte(definition.MinZ) // Min Z
+	w.WriteByte(definition.MaxX) // Max X
+	w.WriteByte(definition.MaxY) // Max Y
+	w.WriteByte(definition.MaxZ) // Max Z
+	w.WriteByte(definition.BlockDraw) // Block Draw
+	w.WriteByte(definition.FogDensity) // Fog Density
+	w.WriteByte(definition.FogR) // Fog R
+	w.WriteByte(definition.FogG) // Fog G
+	w.WriteByte(definition.FogB) // Fog B
+}
+
+func WriteRemoveBlockDefinition(w *packet.PacketWriter, id uint16, extBlocks bool) {
+	w.WriteByte(SERVER_REMOVE_BLOCK_DEFINITION) // Packet ID
+	writeBlock(w, id, extBlocks) // Block ID
+}
+
+func WriteExtAddPlayerName(w *packet.PacketWriter, id byte, playerName string, listName string, groupName string, groupRank byte) {
+	w.WriteByte(SERVER_EXT_ADD_PLAYER_NAME) // Packet ID
+	w.WriteShort(int(id)) // Name ID
+	w.WriteString(playerName) // Player Name (used for autocompletion)
+	w.WriteString(listName) // List Name
+	w.WriteString(groupName) // Group Name
+	w.WriteByte(groupRank) // Group Rank
+}
+
+func WriteExtRemovePlayerName(w *packet.PacketWriter, id byte) {
+	w.WriteByte(SERVER_EXT_REMOVE_PLAYER_NAME) // Packet ID
+	w.WriteShort(int(id)) // Name ID
+}
+
+func WriteExtAddEntity2(w *packet.PacketWriter, id byte, name string, skin string, x int, y int, z int, yaw byte, pitch byte, extPositions bool) {
+	w.WriteByte(SERVER_EXT_ADD_ENTITY_2) // Packet ID
+	w.WriteByte(id) // Entity ID
+	w.WriteString(name) // In Game Name
+	w.WriteString(skin) // Skin Name
+	writePosition(w, x, y, z, extPositions) // X, Y, Z
+	w.WriteByte(yaw) // Yaw (Heading)
+	w.WriteByte(pitch) // Pitch
+}
+
+// FastMap
+func WriteLevelInitializeFastMap(w *packet.PacketWriter, volume int) {
+	w.WriteByte(SERVER_LEVEL_INITIALIZE) // Packet ID
+	w.WriteInt(volume) // Map Volume
+}
+
+func WriteSetSpawnpoint(w *packet.PacketWriter, x int, y int, z int, yaw byte, pitch byte, extPositions bool) {
+	w.WriteByte(SERVER_SET_SPAWNPOINT) // Packet ID
+	writePosition(w, x, y, z, extPositions) // X, Y, Z
+	w.WriteByte(yaw) // Yaw (Heading)
+	w.WriteByte(pitch) // Pitch
+}
+
+func WriteTwoWayPing(w *packet.PacketWriter, direction byte, data int) {
+	w.WriteByte(SERVER_TWO_WAY_PING) // Packet ID
+	w.WriteByte(direction) // Direction
+	w.WriteShort(data) // Data
+}
+
+// Sends up to 256 block changes. indices are block array indices.
+// With ExtendedBlocks, the blocks are followed by the upper 2 bits of each block ID (4 blocks per byte).
+func WriteBulkBlockUpdate(w *packet.PacketWriter, indices []int, blocks []uint16, extBlocks bool) {
+	w.WriteByte(SERVER_BULK_BLOCK_UPDATE) // Packet ID
+	w.WriteByte(byte(len(indices) - 1)) // Count
+
+	for i := 0; i < BULK_BLOCK_UPDATE_SIZE; i++ {
+		if i < len(indices) {
+			w.WriteInt(indices[i]) // Index
+		} else {
+			w.WriteInt(0)
+		}
+	}
+
+	lowerBits := make([]byte, BULK_BLOCK_UPDATE_SIZE)
+	upperBits := make([]byte, BULK_BLOCK_UPDATE_SIZE / 4)
+
+	for i := 0; i < len(blocks); i++ {
+		lowerBits[i] = byte(blocks[i])
+		upperBits[i / 4] |= byte((blocks[i] >> 8) & 0x03) << ((i % 4) * 2)
+	}
+
+	w.WriteBytes(lowerBits) // Blocks
+
+	if extBlocks {
+		w.WriteBytes(upperBits) // Upper Block Bits
+	}
+}
+
+func WriteHackControl(w *packet.PacketWriter, allowed hacks.Hacks) {
+	w.WriteByte(SERVER_HACK_CONTROL) // Packet ID
+	writeBool(w, allowed.Flying) // Flying
+	writeBool(w, allowed.NoClip) // No Clip
+	writeBool(w, allowed.Speeding) // Speeding
+	writeBool(w, allowed.SpawnControl) // Spawn Control
+	writeBool(w, allowed.ThirdPerson) // Third Person View
+	w.WriteShort(allowed.JumpHeight) // Jump Height
+}
+
+// The model is a model name or a block ID, optionally followed by "|" and a scale (for example "chicken|2")
+func WriteChangeModel(w *packet.PacketWriter, id byte, model string) {
+	w.WriteByte(SERVER_CHANGE_MODEL) // Packet ID
+	w.WriteByte(id) // Entity ID
+	w.WriteString(model) // Model Name
+}
+
+// The end coordinates are exclusive, opacity is 0 (invisible) to 255 (opaque)
+func WriteMakeSelection(w *packet.PacketWriter, selectionID byte, label string, startX int, startY int, startZ int, endX int, endY int, endZ int, r int, g int, b int, opacity int) {
+	w.WriteByte(SERVER_MAKE_SELECTION) // Packet ID
+	w.WriteByte(selectionID) // Selection ID
+	w.WriteString(label) // Label
+	w.WriteShort(startX) // Start X
+	w.WriteShort(startY) // Start Y
+	w.WriteShort(startZ) // Start Z
+	w.WriteShort(endX) // End X
+	w.WriteShort(endY) // End Y
+	w.WriteShort(endZ) // End Z
+	w.WriteShort(r) // Red
+	w.WriteShort(g) // Green
+	w.WriteShort(b) // Blue
+	w.WriteShort(opacity) // Opacity
+}
+
+func WriteRemoveSelection(w *packet.PacketWriter, selectionID byte) {
+	w.WriteByte(SERVER_REMOVE_SELECTION) // Packet ID
+	w.WriteByte(selectionID) // Selection ID
+}
+
+// Color components are -1 to reset to the client's default color
+func WriteEnvColors(w *packet.PacketWriter, variable byte, r int, g int, b int) {
+	w.WriteByte(SERVER_ENV_COLORS) // Packet ID
+	w.WriteByte(variable) // Variable
+	w.WriteShort(r) // Red
+	w.WriteShort(g) // Green
+	w.WriteShort(b) // Blue
+}
+
+func WriteSetMapEnvUrl(w *packet.PacketWriter, url string) {
+	w.WriteByte(SERVER_SET_MAP_ENV_URL) // Packet ID
+	w.WriteString(url) // Texture Pack URL
+}
+
+func WriteSetMapEnvProperty(w *packet.PacketWriter, property byte, value int) {
+	w.WriteByte(SERVER_SET_MAP_ENV_PROPERTY) // Packet ID
+	w.WriteByte(property) // Property
+	w.WriteInt(value) // Value
+}
+
+func WriteEnvWeatherType(w *packet.PacketWriter, weather byte) {
+	w.WriteByte(SERVER_ENV_WEATHER_TYPE) // Packet ID
+	w.WriteByte(weather) // Weather Type
+}
+
+func WriteSetBlockPermission(w *packet.PacketWriter, id uint16, allowPlacement bool, allowDeletion bool, extBlocks bool) {
+	w.WriteByte(SERVER_SET_BLOCK_PERMISSION) // Packet ID
+	writeBlock(w, id, extBlocks) // Block Type
+	writeBool(w, allowPlacement) // Allow Placement
+	writeBool(w, allowDeletion) // Allow Deletion
+}
+
+// Blocks with order 0 are hidden from the inventory
+func WriteSetInventoryOrder(w *packet.PacketWriter, id uint16, order uint16, extBlocks bool) {
+	w.WriteByte(SERVER_SET_INVENTORY_ORDER) // Packet ID
+	writeBlock(w, id, extBlocks) // Block
+	writeBlock(w, order, extBlocks) // Order
+}
+
+func WriteSetHotbar(w *packet.PacketWriter, id uint16, index byte, extBlocks bool) {
+	w.WriteByte(SERVER_SET_HOTBAR) // Packet ID
+	writeBlock(w, id, extBlocks) // Block ID
+	w.WriteByte(index) // Hotbar Index
+}
+
+// The distance is in 1/32 blocks
+func WriteClickDistance(w *packet.PacketWriter, distance int) {
+	w.WriteByte(SERVER_CLICK_DISTANCE) // Packet ID
+	w.WriteShort(distance) // Distance
+}
+
+// An empty action removes the hot key
+func WriteSetTextHotKey(w *packet.PacketWriter, label string, action string, keyCode int, keyMods byte) {
+	w.WriteByte(SERVER_SET_TEXT_HOT_KEY) // Packet ID
+	w.WriteString(label) // Label
+	w.WriteString(action) // Action
+	w.WriteInt(keyCode) // Key Code
+	w.WriteByte(keyMods) // Key Mods
+}
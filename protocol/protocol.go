@@ -17,6 +17,7 @@ const (
 	DISCONNECT_SERVER_FULL = "The server is full!"
 	DISCONNECT_MULTIPLE_CONNECTIONS = "You logged in from another computer."
 	DISCONNECT_BANNED = "You're banned!"
+	DISCONNECT_SHUTDOWN = "The server is shutting down."
 	
 	// These messages will never be shown to players with unmodified clients
 
@@ -25,6 +26,7 @@ const (
 	DISCONNECT_CHEAT_NAME = "Cheat detected: Bad name!"
 	DISCONNECT_CHEAT_DISTANCE = "Cheat detected: Distance"
 	DISCONNECT_CHEAT_TILE_TYPE = "Cheat detected: Tile type"
+	DISCONNECT_CHEAT_UNKNOWN_PACKET = "Cheat detected: Unknown packet"
 
 	
 	// Client -> Server
@@ -37,7 +39,7 @@ const (
 	// Server -> Client
 
 	SERVER_IDENTIFICATION = 0x00
-	SERVER_PING = 0x01 // Unused
+	SERVER_PING = 0x01
 	SERVER_LEVEL_INITIALIZE = 0x02
 	SERVER_LEVEL_DATA_CHUNK = 0x03
 	SERVER_LEVEL_FINALIZE = 0x04
@@ -53,6 +55,31 @@ const (
 	SERVER_UPDATE_USER_TYPE = 0x0f
 )
 
+// Client packet lengths (including the packet ID)
+
+var CLIENT_PACKET_LENGTHS = map[byte]int{
+	CLIENT_IDENTIFICATION: 131,
+	CLIENT_SET_BLOCK: 9,
+	CLIENT_POSITION_AND_ORIENTATION: 10,
+	CLIENT_MESSAGE: 66,
+	CLIENT_EXT_INFO: 67,
+	CLIENT_EXT_ENTRY: 69,
+	CLIENT_CUSTOM_BLOCK_SUPPORT_LEVEL: 2,
+	CLIENT_PLAYER_CLICK: 15,
+	CLIENT_TWO_WAY_PING: 4,
+}
+
+// Each connection gets its own copy, since some extensions change packet lengths
+func CopyClientPacketLengths() map[byte]int {
+	lengths := make(map[byte]int)
+
+	for id, length := range CLIENT_PACKET_LENGTHS {
+		lengths[id] = length
+	}
+
+	return lengths
+}
+
 // Packets
 
 func WriteServerIdentification(w *packet.PacketWriter, name string, motd string, op bool) {
@@ -68,6 +95,14 @@ func WriteServerIdentification(w *packet.PacketWriter, name string, motd string,
 	}
 }
 
+func WritePing(w *packet.PacketWriter) {
+	w.WriteByte(SERVER_PING) // Packet ID
+}
+
+func WriteLevelInitialize(w *packet.PacketWriter) {
+	w.WriteByte(SERVER_LEVEL_INITIALIZE) // Packet ID
+}
+
 func WriteLevelDataChunk(w *packet.PacketWriter, data []byte, percentage byte) {
 	w.WriteByte(SERVER_LEVEL_DATA_CHUNK) // Packet ID
 	w.WriteShort(len(data)) // Chunk Length
@@ -82,13 +117,24 @@ func WriteLevelFinalize(w *packet.PacketWriter, level level.Level) {
 	w.WriteShort(level.Depth) // Depth
 }
 
-func WriteSpawnPlayer(w *packet.PacketWriter, name string, id byte, x int, y int, z int, yaw byte, pitch byte) {
+// Positions are sent as ints instead of shorts to clients that support ExtEntityPositions
+func writePosition(w *packet.PacketWriter, x int, y int, z int, extPositions bool) {
+	if extPositions {
+		w.WriteInt(x) // X
+		w.WriteInt(y) // Y
+		w.WriteInt(z) // Z
+	} else {
+		w.WriteShort(x) // X
+		w.WriteShort(y) // Y
+		w.WriteShort(z) // Z
+	}
+}
+
+func WriteSpawnPlayer(w *packet.PacketWriter, name string, id byte, x int, y int, z int, yaw byte, pitch byte, extPositions bool) {
 	w.WriteByte(SERVER_SPAWN_PLAYER) // Packet ID
 	w.WriteByte(id) // Player ID
 	w.WriteString(name) // Player Name
-	w.WriteShort(x) // X
-	w.WriteShort(y) // Y
-	w.WriteShort(z) // Z
+	writePosition(w, x, y, z, extPositions) // X, Y, Z
 	w.WriteByte(yaw) // Yaw (Heading)
 	w.WriteByte(pitch) // Pitch
 }
@@ -109,20 +155,18 @@ func WriteMessage(w *packet.PacketWriter, id byte, message string) {
 	w.WriteString(message) // Message
 }
 
-func WriteSetBlock(w *packet.PacketWriter, x int, y int, z int, id byte) {
+func WriteSetBlock(w *packet.PacketWriter, x int, y int, z int, id uint16, extBlocks bool) {
 	w.WriteByte(SERVER_SET_BLOCK) // Packet ID
 	w.WriteShort(x) // X
 	w.WriteShort(y) // Y
 	w.WriteShort(z) // Z
-	w.WriteByte(id) // Block Type
+	writeBlock(w, id, extBlocks) // Block Type
 }
 
-func WritePositionAndOrientation(w *packet.PacketWriter, id byte, x int, y int, z int, yaw byte, pitch byte) {
+func WritePositionAndOrientation(w *packet.PacketWriter, id byte, x int, y int, z int, yaw byte, pitch byte, extPositions bool) {
 	w.WriteByte(SERVER_POSITION_AND_ORIENTATION) // Packet ID
 	w.WriteByte(id) // Player ID
-	w.WriteShort(x) // X
-	w.WriteShort(y) // Y
-	w.WriteShort(z) // Z
+	writePosition(w, x, y, z, extPositions) // X, Y, Z
 	w.WriteByte(yaw) // Yaw
 	w.WriteByte(pitch) // Pitch
 }
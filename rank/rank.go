@@ -0,0 +1,65 @@
+package rank
+
+import (
+	"goserver/blocks"
+	"goserver/hacks"
+	"goserver/hotkeys"
+	"goserver/permissions"
+	"strings"
+)
+
+type Rank struct {
+	Name string
+	Level byte // Higher levels have more permissions
+	Color string // Color code shown before player names
+	Hacks hacks.Hacks // Hacks that players with this rank can always use, even if the level doesn't allow them
+	Permissions permissions.Permissions // Blocks that players with this rank can't place or break, even if the level allows them
+	ClickDistance int // Reach in 1/32 blocks that overrides the reach of the level (-1 to use the reach of the level)
+	HotKeys []hotkeys.HotKey // Hot keys that are added to the hot keys of the level
+	MaxFillVolume int // Blocks that a single /fill can change (0 if the rank can't use /fill)
+}
+
+var LIQUIDS = []uint16{blocks.BLOCK_FLOWING_WATER, blocks.BLOCK_STATIONARY_WATER, blocks.BLOCK_FLOWING_LAVA, blocks.BLOCK_STATIONARY_LAVA}
+
+var RANKS = []Rank{
+	{"Guest", 0, "&7", hacks.AllowNone(), permissions.CreatePermissions(append([]uint16{blocks.BLOCK_BEDROCK}, LIQUIDS...), []uint16{blocks.BLOCK_BEDROCK}), -1, nil, 0},
+	{"Builder", BUILDER_LEVEL, "&f", hacks.AllowNone(), permissions.CreatePermissions([]uint16{blocks.BLOCK_BEDROCK}, []uint16{blocks.BLOCK_BEDROCK}), -1, nil, 4096},
+	{"Operator", OPERATOR_LEVEL, "&c", hacks.AllowAll(), permissions.AllowAll(), -1, nil, 65536},
+	{"Admin", ADMIN_LEVEL, "&4", hacks.AllowAll(), permissions.AllowAll(), -1, nil, 1048576},
+}
+
+const (
+	DEFAULT_RANK = "Guest"
+
+	// Rank levels that commands require
+
+	BUILDER_LEVEL = 30
+	OPERATOR_LEVEL = 80
+	ADMIN_LEVEL = 100
+)
+
+func GetRank(name string) (Rank, bool) {
+	for _, rank := range RANKS {
+		if strings.EqualFold(rank.Name, name) {
+			return rank, true
+		}
+	}
+
+	return Rank{}, false
+}
+
+// Returns the name of the lowest rank with at least the level
+func LevelName(level byte) string {
+	for _, rank := range RANKS {
+		if rank.Level >= level {
+			return rank.Name
+		}
+	}
+
+	return "Unknown"
+}
+
+func DefaultRank() Rank {
+	rank, _ := GetRank(DEFAULT_RANK)
+	return rank
+}
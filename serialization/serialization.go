@@ -45,7 +45,11 @@ func DecodeString(data []byte, index int) string {
 }
 
 func DecodeShort(data []byte, index int) int {
-	return int((data[index + 0] << 8) + data[index + 1])
+	return (int(data[index + 0]) << 8) + int(data[index + 1])
+}
+
+func DecodeInt(data []byte, index int) int {
+	return int(int32(binary.BigEndian.Uint32(data[index:index + 4])))
 }
 
 func EncodeByteArray(data []byte) []byte {
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"net"
+	"strings"
+)
+
+// Private IPv4 and IPv6 networks
+var LAN_NETWORKS = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// Clients that joined through the heartbeat server send MD5(salt + username) as their token
+func (server *Server) VerifyName(username string, token string) bool {
+	hash := md5.Sum([]byte(server.Salt + username))
+	return strings.EqualFold(hex.EncodeToString(hash[:]), strings.TrimSpace(token))
+}
+
+// Returns whether the address is a loopback, link-local or private network address
+func IsLANAddress(address net.Addr) bool {
+	tcpAddress, ok := address.(*net.TCPAddr)
+
+	if !ok {
+		return false
+	}
+
+	ip := tcpAddress.IP
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return true
+	}
+
+	for _, network := range LAN_NETWORKS {
+		_, ipNet, err := net.ParseCIDR(network)
+
+		if err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Names are verified if verify-names is enabled, unless the client is on the LAN and verify-names-lan-bypass is enabled
+func (server *Server) ShouldVerifyName(client Client) bool {
+	if !server.Config.GetBooleanDefault("verify-names", false) {
+		return false
+	}
+
+	return !(server.Config.GetBooleanDefault("verify-names-lan-bypass", false) && IsLANAddress(client.Socket.RemoteAddr()))
+}
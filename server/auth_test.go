@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"log"
+	"net"
+	"strings"
+	"testing"
+)
+
+// A socket that only has a remote address
+type addressConn struct {
+	net.Conn
+	address net.Addr
+}
+
+func (c *addressConn) RemoteAddr() net.Addr {
+	return c.address
+}
+
+func testToken(salt string, username string) string {
+	hash := md5.Sum([]byte(salt + username))
+	return hex.EncodeToString(hash[:])
+}
+
+func TestVerifyName(t *testing.T) {
+	server := &Server{Salt: "abcdefghijklmnop"}
+	token := testToken(server.Salt, "alice")
+
+	tests := []struct {
+		username string
+		token string
+		valid bool
+	}{
+		{"alice", token, true},
+		{"alice", strings.ToUpper(token), true},
+		{"alice", token + strings.Repeat(" ", 64 - len(token)), true}, // Strings are padded with spaces
+		{"Alice", token, false}, // Names are case sensitive
+		{"bob", token, false},
+		{"alice", testToken("another salt", "alice"), false},
+		{"alice", token[:31], false},
+		{"alice", "", false},
+		{"alice", "-", false},
+	}
+
+	for _, test := range tests {
+		if server.VerifyName(test.username, test.token) != test.valid {
+			t.Errorf("VerifyName(%q, %q) = %t; want %t", test.username, test.token, !test.valid, test.valid)
+		}
+	}
+}
+
+func TestIsLANAddress(t *testing.T) {
+	tests := []struct {
+		ip string
+		lan bool
+	}{
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"::1", true},
+		{"10.0.0.1", true},
+		{"10.255.255.255", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"172.32.0.1", false},
+		{"172.15.255.255", false},
+		{"192.168.1.10", true},
+		{"192.169.0.1", false},
+		{"169.254.1.1", true},
+		{"fe80::1", true},
+		{"fd12:3456::1", true},
+		{"8.8.8.8", false},
+		{"2001:4860:4860::8888", false},
+		{"::ffff:192.168.1.10", true},
+		{"::ffff:8.8.8.8", false},
+	}
+
+	for _, test := range tests {
+		address := &net.TCPAddr{IP: net.ParseIP(test.ip), Port: 25565}
+
+		if IsLANAddress(address) != test.lan {
+			t.Errorf("IsLANAddress(%s) = %t; want %t", test.ip, !test.lan, test.lan)
+		}
+	}
+
+	if IsLANAddress(&net.UDPAddr{IP: net.ParseIP("127.0.0.1")}) {
+		t.Error("a non-TCP address is treated as a LAN address")
+	}
+}
+
+func TestShouldVerifyName(t *testing.T) {
+	lan := Client{Socket: &addressConn{address: &net.TCPAddr{IP: net.ParseIP("192.168.1.10")}}}
+	remote := Client{Socket: &addressConn{address: &net.TCPAddr{IP: net.ParseIP("8.8.8.8")}}}
+
+	tests := []struct {
+		verify string
+		bypass string
+		client Client
+		expected bool
+	}{
+		{"false", "false", remote, false},
+		{"false", "true", remote, false},
+		{"false", "false", lan, false},
+		{"true", "false", remote, true},
+		{"true", "false", lan, true},
+		{"true", "true", remote, true},
+		{"true", "true", lan, false},
+	}
+
+	for _, test := range tests {
+		server := &Server{Config: testConfig(map[string]string{"verify-names": test.verify, "verify-names-lan-bypass": test.bypass})}
+
+		if server.ShouldVerifyName(test.client) != test.expected {
+			t.Errorf("verify-names=%s, verify-names-lan-bypass=%s, %s: got %t; want %t", test.verify, test.bypass, test.client.Socket.RemoteAddr(), !test.expected, test.expected)
+		}
+	}
+
+	// Older configs don't have the options
+	server := &Server{Config: testConfig(nil)}
+	delete(server.Config.Data, "verify-names")
+
+	if server.ShouldVerifyName(remote) {
+		t.Error("names are verified without the verify-names option")
+	}
+}
+
+func TestVerifyNamesWithoutHeartbeatWarning(t *testing.T) {
+	tests := []struct {
+		properties map[string]string
+		warning bool
+	}{
+		{map[string]string{"verify-names": "true"}, true},
+		{map[string]string{"verify-names": "true", "public": "true"}, false},
+		{map[string]string{"verify-names": "true", "heartbeat-url": "http://localhost/heartbeat"}, false},
+		{map[string]string{"verify-names": "false"}, false},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+
+		serverConfig := testConfig(test.properties)
+
+		if _, err := New(Options{Directory: t.TempDir(), Config: &serverConfig, Logger: log.New(&output, "", 0)}); err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(output.String(), "Warning: verify-names") != test.warning {
+			t.Errorf("%v: warning %t; want %t", test.properties, !test.warning, test.warning)
+		}
+	}
+}
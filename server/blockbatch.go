@@ -0,0 +1,216 @@
+package server
+
+import (
+	"goserver/level"
+	"goserver/packet"
+	"goserver/permissions"
+	"goserver/protocol"
+	"strconv"
+)
+
+const (
+	LEVEL_RESEND_THRESHOLD = 4096 // Clients that do not support BulkBlockUpdate get the whole level again instead of more SetBlock packets than this
+)
+
+// Sends the changes in the batch to all clients
+func (server *Server) SendBlockBatch(w *packet.PacketWriter, batch *level.BlockBatch) {
+	if batch.Len() == 0 {
+		return
+	}
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		table := server.BlockConversionTable(server.Clients[i])
+		extBlocks := server.Clients[i].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS)
+
+		if server.Clients[i].SupportsExtension(protocol.EXT_BULK_BLOCK_UPDATE) {
+			for start := 0; start < batch.Len(); start += protocol.BULK_BLOCK_UPDATE_SIZE {
+				end := start + protocol.BULK_BLOCK_UPDATE_SIZE
+
+				if end > batch.Len() {
+					end = batch.Len()
+				}
+
+				converted := make([]uint16, end - start)
+
+				for j := start; j < end; j++ {
+					converted[j - start] = table.Blocks[batch.Blocks[j]]
+				}
+
+				protocol.WriteBulkBlockUpdate(w, batch.Indices[start:end], converted, extBlocks)
+			}
+
+			w.WriteToSocket(server.Clients[i].Socket)
+			continue
+		}
+
+		if batch.Len() > LEVEL_RESEND_THRESHOLD {
+			server.ResendLevel(w, byte(i))
+			continue
+		}
+
+		for j := 0; j < batch.Len(); j++ {
+			index := batch.Indices[j]
+			x := index % batch.Level.Width
+			z := (index / batch.Level.Width) % batch.Level.Depth
+			y := index / (batch.Level.Width * batch.Level.Depth)
+
+			protocol.WriteSetBlock(w, x, y, z, table.Blocks[batch.Blocks[j]], extBlocks)
+		}
+
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+// Sends the whole level to the client again, and moves the client back to where it was.
+// Clients reset the level state (like the environment, block permissions and selections) when they load a level, so the same state as in SendInitialData is sent again.
+func (server *Server) ResendLevel(w *packet.PacketWriter, id byte) {
+	server.SendBlockDefinitions(w, id)
+	server.SendLevel(w, id)
+
+	// Clients without HackControl got the MOTD flags before the level (SendHacks)
+	if server.Clients[id].SupportsExtension(protocol.EXT_HACK_CONTROL) {
+		server.SendHacks(w, id)
+	}
+
+	server.SendEnvironment(w, id)
+	server.SendPermissions(w, id)
+	server.SendControls(w, id)
+	server.ResendSelections(w, id)
+
+	protocol.WritePositionAndOrientation(w, 0xff, server.Clients[id].X, server.Clients[id].Y, server.Clients[id].Z, server.Clients[id].Yaw, server.Clients[id].Pitch, server.Clients[id].SupportsExtension(protocol.EXT_ENTITY_POSITIONS))
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+func sortRange(a int, b int) (int, int) {
+	if a > b {
+		return b, a
+	}
+
+	return a, b
+}
+
+// A fill that has been shown to the player but not applied yet
+type PendingFill struct {
+	MinX  int
+	MinY  int
+	MinZ  int
+	MaxX  int
+	MaxY  int
+	MaxZ  int
+	Block uint16
+}
+
+// Blocks that the player is not allowed to break are left as they are
+func (fill PendingFill) Apply(target *level.Level, username string, allowed permissions.Permissions) *level.BlockBatch {
+	batch := target.CreateBlockBatch(username)
+
+	for y := fill.MinY; y <= fill.MaxY; y++ {
+		for z := fill.MinZ; z <= fill.MaxZ; z++ {
+			for x := fill.MinX; x <= fill.MaxX; x++ {
+				block := target.GetBlock(x, y, z)
+
+				if block != fill.Block && allowed.CanBreak(block) {
+					batch.SetBlock(x, y, z, fill.Block)
+				}
+			}
+		}
+	}
+
+	return batch
+}
+
+// /fill <x1> <y1> <z1> <x2> <y2> <z2> <block>
+// /fill <confirm|cancel>
+func (server *Server) FillCommand(w *packet.PacketWriter, id byte, arguments []string) {
+	if len(arguments) == 1 && (arguments[0] == "confirm" || arguments[0] == "cancel") {
+		fill := server.Clients[id].PendingFill
+
+		if fill == nil {
+			server.SendChatMessage(w, id, 0xff, "There is no fill to "+arguments[0]+".")
+			return
+		}
+
+		server.Clients[id].PendingFill = nil
+		server.HideSelection(w, id, SELECTION_ID_FILL)
+
+		if arguments[0] == "cancel" {
+			server.SendChatMessage(w, id, 0xff, "Fill cancelled.")
+			return
+		}
+
+		allowed := server.ClientPermissions(server.Clients[id])
+
+		if !allowed.CanPlace(fill.Block) {
+			server.SendChatMessage(w, id, 0xff, "You are not allowed to place block "+strconv.Itoa(int(fill.Block))+".")
+			return
+		}
+
+		batch := fill.Apply(&server.Level, server.Clients[id].Username, allowed)
+
+		server.SendBlockBatch(w, batch)
+		server.SendChatMessage(w, id, 0xff, "Filled "+strconv.Itoa(batch.Len())+" blocks.")
+		return
+	}
+
+	if len(arguments) != 7 {
+		server.SendChatMessage(w, id, 0xff, "Usage: /fill <x1> <y1> <z1> <x2> <y2> <z2> <block>")
+		return
+	}
+
+	numbers := make([]int, 6)
+
+	for i := 0; i < 6; i++ {
+		number, err := strconv.Atoi(arguments[i])
+
+		if err != nil {
+			server.SendChatMessage(w, id, 0xff, "Invalid coordinate \""+arguments[i]+"\".")
+			return
+		}
+
+		numbers[i] = number
+	}
+
+	block, ok := parseBlock(arguments[6])
+
+	if !ok || !server.CanPlaceBlock(server.Clients[id], block) {
+		server.SendChatMessage(w, id, 0xff, "Invalid block \""+arguments[6]+"\".")
+		return
+	}
+
+	if !server.ClientPermissions(server.Clients[id]).CanPlace(block) {
+		server.SendChatMessage(w, id, 0xff, "You are not allowed to place block "+arguments[6]+".")
+		return
+	}
+
+	minX, maxX := sortRange(numbers[0], numbers[3])
+	minY, maxY := sortRange(numbers[1], numbers[4])
+	minZ, maxZ := sortRange(numbers[2], numbers[5])
+
+	if server.Level.IsOOB(minX, minY, minZ) || server.Level.IsOOB(maxX, maxY, maxZ) {
+		server.SendChatMessage(w, id, 0xff, "The area is outside of the level.")
+		return
+	}
+
+	volume := (maxX - minX + 1) * (maxY - minY + 1) * (maxZ - minZ + 1)
+	maxVolume := server.Clients[id].Rank.MaxFillVolume
+
+	if maxVolume == 0 {
+		server.SendChatMessage(w, id, 0xff, "Your rank is not allowed to use /fill.")
+		return
+	}
+
+	if volume > maxVolume {
+		server.SendChatMessage(w, id, 0xff, "You can fill at most "+strconv.Itoa(maxVolume)+" blocks at once, but the area has "+strconv.Itoa(volume)+" blocks.")
+		return
+	}
+
+	server.Clients[id].PendingFill = &PendingFill{minX, minY, minZ, maxX, maxY, maxZ, block}
+
+	server.ShowSelection(w, id, SELECTION_ID_FILL, Selection{"Fill", minX, minY, minZ, maxX, maxY, maxZ, 255, 255, 0, 96})
+
+	server.SendChatMessage(w, id, 0xff, "This will fill "+strconv.Itoa(volume)+" blocks. Type /fill confirm to fill them, or /fill cancel.")
+}
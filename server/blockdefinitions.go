@@ -0,0 +1,393 @@
+package server
+
+import (
+	"errors"
+	"goserver/blocks"
+	"goserver/command"
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/rank"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	GLOBAL_BLOCKS_FILE = "global.blocks"
+	MAIN_LEVEL_BLOCKS_FILE = MAIN_LEVEL_FILE + ".blocks"
+)
+
+func (server *Server) LoadBlockDefinitions(file string) (blocks.BlockDefinitions, error) {
+	path := server.Path(file)
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return make(blocks.BlockDefinitions), nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	definitions, err := blocks.DeserializeBlockDefinitions(content)
+
+	if err != nil {
+		return nil, errors.New("failed to load " + file + ": " + err.Error())
+	}
+
+	return definitions, nil
+}
+
+// Saves the block definitions in the background (this must be called from the server goroutine)
+func (server *Server) SaveBlockDefinitions() {
+	server.queueBlockDefinitions()
+	server.writeQueuedFilesLater()
+}
+
+func (server *Server) queueBlockDefinitions() {
+	server.QueueFileWrite(GLOBAL_BLOCKS_FILE, server.GlobalBlockDefinitions.Serialize())
+	server.QueueFileWrite(MAIN_LEVEL_BLOCKS_FILE, server.LevelBlockDefinitions.Serialize())
+}
+
+// Level block definitions override global block definitions
+func (server *Server) GetBlockDefinition(id uint16) (blocks.BlockDefinition, bool) {
+	definition, exists := server.LevelBlockDefinitions[id]
+
+	if exists {
+		return definition, true
+	}
+
+	definition, exists = server.GlobalBlockDefinitions[id]
+	return definition, exists
+}
+
+// Returns the block that the client is shown instead of the given block
+func (server *Server) ConvertBlock(client Client, id uint16) uint16 {
+	definition, defined := server.GetBlockDefinition(id)
+
+	if defined && (!client.SupportsExtension(protocol.EXT_BLOCK_DEFINITIONS) || (id > blocks.BLOCK_MAX_BYTE && !client.SupportsExtension(protocol.EXT_EXTENDED_BLOCKS))) {
+		id = uint16(definition.Fallback)
+	}
+
+	// Undefined blocks above 255 can only be left behind by removed block definitions
+	if id > blocks.BLOCK_MAX_BYTE && !client.SupportsExtension(protocol.EXT_EXTENDED_BLOCKS) {
+		id = blocks.BLOCK_STONE
+	}
+
+	if client.CustomBlocksLevel == 0 {
+		id = blocks.Fallback(id)
+	}
+
+	return id
+}
+
+func (server *Server) BlockConversionTable(client Client) level.ConversionTable {
+	table := level.ConversionTable{Extended: client.SupportsExtension(protocol.EXT_EXTENDED_BLOCKS)}
+
+	for i := 0; i < len(table.Blocks); i++ {
+		table.Blocks[i] = server.ConvertBlock(client, uint16(i))
+	}
+
+	return table
+}
+
+func (server *Server) CanPlaceBlock(client Client, id uint16) bool {
+	if id <= blocks.BLOCK_MAX_CLASSIC {
+		return true
+	}
+
+	if client.CustomBlocksLevel != 0 && id <= blocks.BLOCK_MAX_CUSTOM_BLOCKS {
+		return true
+	}
+
+	if id > blocks.BLOCK_MAX_BYTE && !client.SupportsExtension(protocol.EXT_EXTENDED_BLOCKS) {
+		return false
+	}
+
+	_, defined := server.GetBlockDefinition(id)
+
+	return defined && client.SupportsExtension(protocol.EXT_BLOCK_DEFINITIONS)
+}
+
+// Clients that do not support ExtendedBlocks are not sent definitions of blocks above 255
+func WriteBlockDefinition(w *packet.PacketWriter, client Client, definition blocks.BlockDefinition) {
+	extBlocks := client.SupportsExtension(protocol.EXT_EXTENDED_BLOCKS)
+
+	if definition.ID > blocks.BLOCK_MAX_BYTE && !extBlocks {
+		return
+	}
+
+	if client.SupportsExtension(protocol.EXT_BLOCK_DEFINITIONS_EXT) && !definition.Sprite {
+		protocol.WriteDefineBlockExt(w, definition, extBlocks)
+	} else {
+		protocol.WriteDefineBlock(w, definition, extBlocks)
+	}
+}
+
+func (server *Server) SendBlockDefinitions(w *packet.PacketWriter, id byte) {
+	if !server.Clients[id].SupportsExtension(protocol.EXT_BLOCK_DEFINITIONS) {
+		return
+	}
+
+	for i := 0; i < blocks.BLOCK_COUNT; i++ {
+		definition, defined := server.GetBlockDefinition(uint16(i))
+
+		if !defined {
+			continue
+		}
+
+		WriteBlockDefinition(w, server.Clients[id], definition)
+	}
+
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+// Sends the current definition of a block (or its removal) to all clients
+func (server *Server) SendBlockDefinitionToAllClients(w *packet.PacketWriter, id uint16) {
+	definition, defined := server.GetBlockDefinition(id)
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].SupportsExtension(protocol.EXT_BLOCK_DEFINITIONS) {
+			continue
+		}
+
+		extBlocks := server.Clients[i].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS)
+
+		if id > blocks.BLOCK_MAX_BYTE && !extBlocks {
+			continue
+		}
+
+		if defined {
+			WriteBlockDefinition(w, server.Clients[i], definition)
+		} else {
+			protocol.WriteRemoveBlockDefinition(w, id, extBlocks)
+		}
+
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+func parseByte(value string) (byte, bool) {
+	number, err := strconv.ParseUint(value, 10, 8)
+	return byte(number), err == nil
+}
+
+func parseBlock(value string) (uint16, bool) {
+	number, err := strconv.ParseUint(value, 10, 16)
+	return uint16(number), err == nil && number <= blocks.BLOCK_MAX_EXTENDED
+}
+
+func parseBytes(values []string, count int) ([]byte, bool) {
+	if len(values) != count {
+		return nil, false
+	}
+
+	output := make([]byte, count)
+
+	for i := 0; i < count; i++ {
+		number, ok := parseByte(values[i])
+
+		if !ok {
+			return nil, false
+		}
+
+		output[i] = number
+	}
+
+	return output, true
+}
+
+func SetBlockDefinitionProperty(definition *blocks.BlockDefinition, property string, values []string) bool {
+	if property == "name" {
+		definition.Name = strings.Join(values, " ")
+		return len(definition.Name) != 0
+	}
+
+	if property == "light" || property == "fullbright" || property == "sprite" {
+		if len(values) != 1 || (values[0] != "true" && values[0] != "false") {
+			return false
+		}
+
+		value := values[0] == "true"
+
+		switch property {
+		case "light":
+			definition.TransmitsLight = value
+		case "fullbright":
+			definition.FullBright = value
+		case "sprite":
+			definition.Sprite = value
+		}
+
+		return true
+	}
+
+	if property == "min" || property == "max" {
+		box, ok := parseBytes(values, 3)
+
+		if !ok || box[0] > 16 || box[1] > 16 || box[2] > 16 {
+			return false
+		}
+
+		if property == "min" {
+			definition.MinX, definition.MinY, definition.MinZ = box[0], box[1], box[2]
+		} else {
+			definition.MaxX, definition.MaxY, definition.MaxZ = box[0], box[1], box[2]
+		}
+
+		return true
+	}
+
+	if property == "fog" {
+		fog, ok := parseBytes(values, 4)
+
+		if !ok {
+			return false
+		}
+
+		definition.FogDensity, definition.FogR, definition.FogG, definition.FogB = fog[0], fog[1], fog[2], fog[3]
+		return true
+	}
+
+	value, ok := parseBytes(values, 1)
+
+	if !ok {
+		return false
+	}
+
+	switch property {
+	case "fallback":
+		if value[0] > blocks.BLOCK_MAX_CUSTOM_BLOCKS {
+			return false
+		}
+
+		definition.Fallback = value[0]
+	case "solidity":
+		definition.Solidity = value[0]
+	case "speed":
+		definition.MovementSpeed = value[0]
+	case "texture":
+		definition.TopTexture = value[0]
+		definition.LeftTexture = value[0]
+		definition.RightTexture = value[0]
+		definition.FrontTexture = value[0]
+		definition.BackTexture = value[0]
+		definition.BottomTexture = value[0]
+	case "top":
+		definition.TopTexture = value[0]
+	case "side":
+		definition.LeftTexture = value[0]
+		definition.RightTexture = value[0]
+		definition.FrontTexture = value[0]
+		definition.BackTexture = value[0]
+	case "bottom":
+		definition.BottomTexture = value[0]
+	case "left":
+		definition.LeftTexture = value[0]
+	case "right":
+		definition.RightTexture = value[0]
+	case "front":
+		definition.FrontTexture = value[0]
+	case "back":
+		definition.BackTexture = value[0]
+	case "sound":
+		definition.WalkSound = value[0]
+	case "draw":
+		definition.BlockDraw = value[0]
+	default:
+		return false
+	}
+
+	return true
+}
+
+// /blockdef define <global|level> <id> <fallback> <name>
+// /blockdef set <global|level> <id> <property> <value>
+// /blockdef remove <global|level> <id>
+func (server *Server) BlockDefinitionCommand(w *packet.PacketWriter, id byte, parsedCommand command.Command) {
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	arguments := parsedCommand.Arguments
+	usage := "Usage: /blockdef <define|set|remove> <global|level> <id> ..."
+
+	if 3 > len(arguments) {
+		server.SendChatMessage(w, id, 0xff, usage)
+		return
+	}
+
+	definitions := server.LevelBlockDefinitions
+
+	if arguments[1] == "global" {
+		definitions = server.GlobalBlockDefinitions
+	} else if arguments[1] != "level" {
+		server.SendChatMessage(w, id, 0xff, usage)
+		return
+	}
+
+	blockID, ok := parseBlock(arguments[2])
+
+	if !ok || blockID == blocks.BLOCK_AIR {
+		server.SendChatMessage(w, id, 0xff, "Invalid block ID \""+arguments[2]+"\".")
+		return
+	}
+
+	message := ""
+	changed := false
+
+	switch arguments[0] {
+	case "define":
+		fallback, ok := byte(0), false
+
+		if len(arguments) > 4 {
+			fallback, ok = parseByte(arguments[3])
+		}
+
+		if !ok || fallback > blocks.BLOCK_MAX_CUSTOM_BLOCKS {
+			message = "Usage: /blockdef define <global|level> <id> <fallback> <name>"
+			break
+		}
+
+		definitions[blockID] = blocks.CreateBlockDefinition(blockID, strings.Join(arguments[4:], " "), fallback)
+		message = "Defined block " + arguments[2] + "."
+		changed = true
+	case "set":
+		definition, exists := definitions[blockID]
+
+		if !exists {
+			message = "Block " + arguments[2] + " is not defined."
+			break
+		}
+
+		if 5 > len(arguments) || !SetBlockDefinitionProperty(&definition, arguments[3], arguments[4:]) {
+			message = "Usage: /blockdef set <global|level> <id> <property> <value>"
+			break
+		}
+
+		definitions[blockID] = definition
+		message = "Updated block " + arguments[2] + "."
+		changed = true
+	case "remove":
+		if _, exists := definitions[blockID]; !exists {
+			message = "Block " + arguments[2] + " is not defined."
+			break
+		}
+
+		delete(definitions, blockID)
+		message = "Removed block " + arguments[2] + "."
+		changed = true
+	default:
+		message = usage
+	}
+
+	server.SendChatMessage(w, id, 0xff, message)
+
+	if changed {
+		server.SaveBlockDefinitions()
+		server.SendBlockDefinitionToAllClients(w, blockID)
+	}
+}
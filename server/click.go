@@ -0,0 +1,54 @@
+package server
+
+import (
+	"goserver/event"
+	"goserver/packet"
+	"goserver/protocol"
+	"strconv"
+)
+
+func (server *Server) HandlePlayerClick(r *packet.PacketReader, id byte) {
+	if !server.Clients[id].SupportsExtension(protocol.EXT_PLAYER_CLICK) || !server.Clients[id].Joined {
+		return
+	}
+
+	click := event.PlayerClick{PlayerID: id, Username: server.Clients[id].Username}
+
+	click.Button = r.ReadByte()
+	click.Action = r.ReadByte()
+	click.Yaw = r.ReadShort()
+	click.Pitch = r.ReadShort()
+	click.TargetEntity = r.ReadByte()
+	click.TargetX = r.ReadShort()
+	click.TargetY = r.ReadShort()
+	click.TargetZ = r.ReadShort()
+	click.TargetFace = r.ReadByte()
+
+	server.Events.FirePlayerClick(click)
+}
+
+func (server *Server) RegisterClickHandlers() {
+	// /blockinfo: click a block to see who placed it
+
+	server.Events.OnPlayerClick(func(click event.PlayerClick) {
+		if !server.Clients[click.PlayerID].BlockInfoMode || click.Action != protocol.CLICK_ACTION_PRESS || !click.HasTargetBlock() {
+			return
+		}
+
+		if server.Level.IsOOB(click.TargetX, click.TargetY, click.TargetZ) {
+			return
+		}
+
+		w := packet.CreatePacketWriter()
+		position := strconv.Itoa(click.TargetX) + ", " + strconv.Itoa(click.TargetY) + ", " + strconv.Itoa(click.TargetZ)
+		block := strconv.Itoa(int(server.Level.GetBlock(click.TargetX, click.TargetY, click.TargetZ)))
+		update, exists := server.Level.LastBlockUpdate(click.TargetX, click.TargetY, click.TargetZ)
+
+		if !exists || update.Name == "" {
+			server.SendChatMessage(&w, click.PlayerID, 0xff, "Block at "+position+" is ID "+block+".")
+			return
+		}
+
+		server.SendChatMessage(&w, click.PlayerID, 0xff, "Block at "+position+" is ID "+block+", placed by "+update.Name+".")
+	})
+}
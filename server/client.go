@@ -0,0 +1,787 @@
+package server
+
+import (
+	"errors"
+	"goserver/blocks"
+	"goserver/compression"
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/command"
+	"goserver/rank"
+	"goserver/serialization"
+	"goserver/websocket"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	Username string
+	ID       byte
+	X        int
+	Y        int
+	Z        int
+	Yaw      byte
+	Pitch    byte
+	Socket   net.Conn // Writes are queued (see SEND_QUEUE_SIZE), so they never block
+
+	Rank        rank.Rank
+	DisplayName string // Name shown above the player (the player list always uses the username)
+	Model       string // Model name or block ID (ChangeModel)
+	Skin        string // Skin name or URL (ExtPlayerList)
+
+	MessageSlots   map[byte]string // Message type -> last message sent to the client in chat (for clients that do not support MessageTypes)
+	PartialMessage string          // Message parts that have been received so far (LongerMessages)
+
+	Latency  time.Duration // Round-trip time of the last answered ping (TwoWayPing)
+	PingSent time.Time     // When the unanswered ping was sent
+	PingData int           // Data of the last ping sent to the client
+
+	BlockInfoMode bool         // Whether clicking a block shows who placed it (/blockinfo)
+	PendingFill   *PendingFill // Fill waiting for /fill confirm
+
+	Selections map[byte]Selection // Selection ID -> selection shown to the client (SelectionCuboid), removed with the client slot when the client disconnects
+
+	// Classic Protocol Extension
+
+	CPE               bool           // Whether the client sent the CPE magic byte in its identification packet
+	AppName           string         // Client software name
+	Extensions        map[string]int // Extension name -> version
+	PendingExtensions int            // Number of ExtEntry packets that have not been received yet
+	CustomBlocksLevel byte           // CustomBlocks support level (0 if the client does not support CustomBlocks)
+	PacketLengths     map[byte]int   // Client packet lengths used by the packet framer
+
+	Joined bool // Whether the initial data has been sent to the client
+}
+
+func (client Client) SupportsExtension(name string) bool {
+	version, exists := client.Extensions[name]
+	return exists && version == protocol.ServerExtensionVersion(name)
+}
+
+var NULL_CLIENT Client
+
+func (server *Server) SendToAllClients(exclude byte, w *packet.PacketWriter) {
+	data := w.Buffer
+	w.Buffer = make([]byte, 0)
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil {
+			continue
+		}
+
+		if exclude != 0xff && byte(i) == exclude {
+			continue
+		}
+
+		server.Clients[i].Socket.Write(data)
+	}
+}
+
+func (server *Server) HandleIdentification(r *packet.PacketReader, w *packet.PacketWriter, id byte) {
+	// The name can't be changed after identifying
+	if server.Clients[id].Username != "" {
+		return
+	}
+
+	r.Reset()
+	r.ReadByte()
+
+	if r.ReadByte() != protocol.PROTOCOL_VERSION {
+		protocol.WriteDisconnect(w, protocol.DISCONNECT_PROTOCOL_VERSION)
+		w.WriteToSocket(server.Clients[id].Socket)
+		server.Clients[id].Socket.Close()
+		return
+	}
+
+	username := r.ReadString()
+	token := r.ReadString()
+
+	if server.ShouldVerifyName(server.Clients[id]) && !server.VerifyName(username, token) {
+		server.logger.Println("Failed to verify the name of", username)
+		protocol.WriteDisconnect(w, protocol.DISCONNECT_INVALID_NAME)
+		w.WriteToSocket(server.Clients[id].Socket)
+		server.Clients[id].Socket.Close()
+		return
+	}
+
+	// Clients that are still connecting don't count as players until they identify
+	players := 0
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket != nil && server.Clients[i].Username != "" {
+			players++
+		}
+	}
+
+	if players >= server.MaxPlayers() {
+		protocol.WriteDisconnect(w, protocol.DISCONNECT_SERVER_FULL)
+		w.WriteToSocket(server.Clients[id].Socket)
+		server.Clients[id].Socket.Close()
+		return
+	}
+
+	server.Clients[id].Username = username
+	server.Clients[id].DisplayName = server.Clients[id].Username
+	server.Clients[id].Rank = server.GetPlayerRank(server.Clients[id].Username)
+	server.Clients[id].Model = server.GetPlayerModel(server.Clients[id].Username)
+	server.Clients[id].Skin = server.GetPlayerSkin(server.Clients[id].Username)
+
+	if r.ReadByte() == protocol.CPE_MAGIC {
+		server.Clients[id].CPE = true
+
+		protocol.WriteExtInfo(w, protocol.CPE_APP_NAME, len(protocol.SERVER_EXTENSIONS))
+
+		for _, extension := range protocol.SERVER_EXTENSIONS {
+			protocol.WriteExtEntry(w, extension.Name, extension.Version)
+		}
+
+		w.WriteToSocket(server.Clients[id].Socket)
+
+		// The rest of the initial data is sent once the client has sent all of its extensions
+
+		return
+	}
+
+	server.SendInitialData(w, id)
+}
+
+func (server *Server) HandleExtInfo(r *packet.PacketReader, w *packet.PacketWriter, id byte) {
+	if !server.Clients[id].CPE || server.Clients[id].Extensions != nil {
+		return
+	}
+
+	server.Clients[id].AppName = r.ReadString()
+	server.Clients[id].PendingExtensions = r.ReadShort()
+	server.Clients[id].Extensions = make(map[string]int)
+
+	server.logger.Println(server.Clients[id].Username, "is using", server.Clients[id].AppName, "with", server.Clients[id].PendingExtensions, "extensions")
+
+	if server.Clients[id].PendingExtensions <= 0 {
+		server.FinishNegotiation(w, id)
+	}
+}
+
+func (server *Server) HandleExtEntry(r *packet.PacketReader, w *packet.PacketWriter, id byte) {
+	if server.Clients[id].Extensions == nil || server.Clients[id].PendingExtensions == 0 {
+		return
+	}
+
+	name := r.ReadString()
+	server.Clients[id].Extensions[name] = r.ReadInt()
+	server.Clients[id].PendingExtensions--
+
+	if server.Clients[id].PendingExtensions == 0 {
+		server.FinishNegotiation(w, id)
+	}
+}
+
+// Called once the client has sent all of its extensions
+func (server *Server) FinishNegotiation(w *packet.PacketWriter, id byte) {
+	if server.Clients[id].SupportsExtension(protocol.EXT_ENTITY_POSITIONS) {
+		server.Clients[id].PacketLengths[protocol.CLIENT_POSITION_AND_ORIENTATION] = protocol.CLIENT_POSITION_AND_ORIENTATION_EXT_LENGTH
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS) {
+		server.Clients[id].PacketLengths[protocol.CLIENT_SET_BLOCK] = protocol.CLIENT_SET_BLOCK_EXT_LENGTH
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_CUSTOM_BLOCKS) {
+		// The initial data is sent once the client has sent its support level
+
+		protocol.WriteCustomBlockSupportLevel(w, protocol.CUSTOM_BLOCKS_SUPPORT_LEVEL)
+		w.WriteToSocket(server.Clients[id].Socket)
+		return
+	}
+
+	server.SendInitialData(w, id)
+}
+
+func (server *Server) HandleCustomBlockSupportLevel(r *packet.PacketReader, w *packet.PacketWriter, id byte) {
+	if !server.Clients[id].SupportsExtension(protocol.EXT_CUSTOM_BLOCKS) || server.Clients[id].Joined {
+		return
+	}
+
+	server.Clients[id].CustomBlocksLevel = r.ReadByte()
+
+	if server.Clients[id].CustomBlocksLevel > protocol.CUSTOM_BLOCKS_SUPPORT_LEVEL {
+		server.Clients[id].CustomBlocksLevel = protocol.CUSTOM_BLOCKS_SUPPORT_LEVEL
+	}
+
+	server.SendInitialData(w, id)
+}
+
+func (server *Server) SendBlockToAllClients(w *packet.PacketWriter, x int, y int, z int, id uint16) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil {
+			continue
+		}
+
+		protocol.WriteSetBlock(w, x, y, z, server.ConvertBlock(server.Clients[i], id), server.Clients[i].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS))
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
+
+// Sends the client's new position to all other clients. Relative updates only fit small movements, so larger movements are sent as teleports.
+func (server *Server) SendMovementToAllClients(w *packet.PacketWriter, id byte, oldX int, oldY int, oldZ int) {
+	client := server.Clients[id]
+	teleport := abs(client.X - oldX) > 127 || abs(client.Y - oldY) > 127 || abs(client.Z - oldZ) > 127
+
+	for i := 0; i < len(server.Clients); i++ {
+		if i == int(id) || server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		if teleport {
+			protocol.WritePositionAndOrientation(w, id, client.X, client.Y, client.Z, client.Yaw, client.Pitch, server.Clients[i].SupportsExtension(protocol.EXT_ENTITY_POSITIONS))
+		} else {
+			protocol.WritePositionAndOrientationUpdate(w, id, oldX, oldY, oldZ, client.X, client.Y, client.Z, client.Yaw, client.Pitch)
+		}
+
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+// Updates the spawnpoint of clients that support SetSpawnpoint
+func (server *Server) SendSpawnpointToAllClients(w *packet.PacketWriter) {
+	spawnpoint := server.Level.Spawnpoint
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined || !server.Clients[i].SupportsExtension(protocol.EXT_SET_SPAWNPOINT) {
+			continue
+		}
+
+		protocol.WriteSetSpawnpoint(w, (spawnpoint.X<<5)+16, (spawnpoint.Y<<5)+16, (spawnpoint.Z<<5)+16, spawnpoint.Yaw, spawnpoint.Pitch, server.Clients[i].SupportsExtension(protocol.EXT_ENTITY_POSITIONS))
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+// Sends the level data (Level Initialize, Level Data Chunks and Level Finalize) to the client
+// The whole level is sent as one write, so that it takes a single entry of the send queue no matter how large it is
+func (server *Server) SendLevel(w *packet.PacketWriter, id byte) {
+	conversionTable := server.BlockConversionTable(server.Clients[id])
+	var compressedLevel []byte
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_FAST_MAP) {
+		protocol.WriteLevelInitializeFastMap(w, len(server.Level.Data)) // Level Initialize
+		compressedLevel = server.Level.DeflateConverted(conversionTable)
+	} else {
+		protocol.WriteLevelInitialize(w) // Level Initialize
+		compressedLevel = compression.CompressData(server.Level.EncodeConverted(conversionTable))
+	}
+
+	splitCompressedEncodedLevel := serialization.SplitData(compressedLevel, 1024)
+
+	for i := 0; i < len(splitCompressedEncodedLevel); i++ {
+		percentage := byte((float32(i+1) / float32(len(splitCompressedEncodedLevel))) * 100)
+		protocol.WriteLevelDataChunk(w, splitCompressedEncodedLevel[i], percentage) // Level Data Chunk
+	}
+
+	protocol.WriteLevelFinalize(w, server.Level) // Level Finalize
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+func (server *Server) SendInitialData(w *packet.PacketWriter, id byte) {
+	username := server.Clients[id].Username
+	server.Clients[id].Joined = true
+
+	protocol.WriteServerIdentification(w, server.Config.GetStringDefault("server-name", DEFAULT_SERVER_NAME), server.HacksMOTD(server.Clients[id]), false) // Server Identification
+	w.WriteToSocket(server.Clients[id].Socket)
+
+	server.SendBlockDefinitions(w, id)
+
+	server.SendLevel(w, id)
+
+	server.Clients[id].X = int(float32(server.Level.Spawnpoint.X) * 32.0)
+	server.Clients[id].Y = int(float32(server.Level.Spawnpoint.Y) * 32.0)
+	server.Clients[id].Z = int(float32(server.Level.Spawnpoint.Z) * 32.0)
+	server.Clients[id].Yaw = server.Level.Spawnpoint.Yaw
+	server.Clients[id].Pitch = server.Level.Spawnpoint.Pitch
+
+	// Spawn Player
+
+	server.WriteSpawnClient(w, server.Clients[id], server.Clients[id], 0xff, (server.Level.Spawnpoint.X<<5)+16, (server.Level.Spawnpoint.Y<<5)+16, (server.Level.Spawnpoint.Z<<5)+16, server.Clients[id].Yaw, server.Clients[id].Pitch)
+	w.WriteToSocket(server.Clients[id].Socket)
+
+	for i := 0; i < len(server.Clients); i++ {
+		if i == int(id) || server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		server.WriteSpawnClient(w, server.Clients[i], server.Clients[id], server.Clients[id].ID, server.Clients[id].X, server.Clients[id].Y, server.Clients[id].Z, server.Clients[id].Yaw, server.Clients[id].Pitch)
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+
+	server.SendPlayerListAdd(w, id)
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_HACK_CONTROL) {
+		server.SendHacks(w, id)
+	}
+
+	server.SendEnvironment(w, id)
+	server.SendPermissions(w, id)
+	server.SendControls(w, id)
+
+	if _, err := os.Stat(server.Path(WELCOME_FILE)); errors.Is(err, os.ErrNotExist) {
+		server.logger.Println("Cannot find welcome.txt, not showing welcome message.")
+	} else {
+		welcomeMessageData, err := ioutil.ReadFile(server.Path(WELCOME_FILE))
+
+		if err != nil {
+			server.logger.Println("Failed to load welcome.txt, but the file exists! Something is broken!")
+			server.logger.Println("Here is the complete error message:")
+			server.logger.Println(err)
+			return
+		}
+
+		lines := strings.Split(string(welcomeMessageData), "\n")
+
+		// Send the welcome message to the client
+
+		for _, line := range lines {
+			server.SendChatMessage(w, id, 126, line)
+		}
+
+		// Send a blank line at the end if it wasn't already sent
+
+		server.logger.Println(len(lines[len(lines)-1]))
+
+		if len(lines[len(lines)-1]) != 0 {
+			server.SendChatMessage(w, id, 126, "")
+		}
+	}
+
+	server.SendChatToAllClients(w, 0xff, username+" joined the game") // Send join message
+
+	for i := 0; i < len(server.Clients); i++ {
+		if i == int(server.Clients[id].ID) || server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		server.WriteSpawnClient(w, server.Clients[id], server.Clients[i], byte(i), server.Clients[i].X, server.Clients[i].Y, server.Clients[i].Z, server.Clients[i].Yaw, server.Clients[i].Pitch)
+		w.WriteToSocket(server.Clients[id].Socket)
+	}
+}
+
+// Packets that are handled before the client has joined (the rest are ignored until the initial data has been sent)
+func isLoginPacket(packetID byte) bool {
+	switch packetID {
+	case protocol.CLIENT_IDENTIFICATION, protocol.CLIENT_EXT_INFO, protocol.CLIENT_EXT_ENTRY, protocol.CLIENT_CUSTOM_BLOCK_SUPPORT_LEVEL, protocol.CLIENT_TWO_WAY_PING:
+		return true
+	}
+
+	return false
+}
+
+func (server *Server) HandleMessage(r *packet.PacketReader, w *packet.PacketWriter, id byte) {
+	packetID := r.ReadByte()
+
+	if !server.Clients[id].Joined && !isLoginPacket(packetID) {
+		return
+	}
+
+	if packetID == protocol.CLIENT_IDENTIFICATION {
+		server.HandleIdentification(r, w, id)
+		return
+	}
+
+	if packetID == protocol.CLIENT_EXT_INFO {
+		server.HandleExtInfo(r, w, id)
+		return
+	}
+
+	if packetID == protocol.CLIENT_EXT_ENTRY {
+		server.HandleExtEntry(r, w, id)
+		return
+	}
+
+	if packetID == protocol.CLIENT_CUSTOM_BLOCK_SUPPORT_LEVEL {
+		server.HandleCustomBlockSupportLevel(r, w, id)
+		return
+	}
+
+	if packetID == protocol.CLIENT_TWO_WAY_PING {
+		server.HandleTwoWayPing(r, w, id)
+		return
+	}
+
+	if packetID == protocol.CLIENT_PLAYER_CLICK {
+		server.HandlePlayerClick(r, id)
+		return
+	}
+
+	if packetID == protocol.CLIENT_SET_BLOCK {
+		// TODO: reimplement the anti-cheat code for this
+
+		x := r.ReadShort()
+		y := r.ReadShort()
+		z := r.ReadShort()
+		update_type := r.ReadByte()
+		block_type := uint16(0)
+
+		if server.Clients[id].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS) {
+			block_type = uint16(r.ReadShort())
+		} else {
+			block_type = uint16(r.ReadByte())
+		}
+
+		if server.Level.IsOOB(x, y, z) {
+			return
+		}
+
+		if update_type != 0x01 {
+			block_type = blocks.BLOCK_AIR
+		}
+
+		if !server.CanPlaceBlock(server.Clients[id], block_type) {
+			protocol.WriteDisconnect(w, protocol.DISCONNECT_CHEAT_TILE_TYPE)
+			w.WriteToSocket(server.Clients[id].Socket)
+			server.Clients[id].Socket.Close()
+			return
+		}
+
+		allowed := server.ClientPermissions(server.Clients[id])
+		currentBlock := server.Level.GetBlock(x, y, z)
+
+		if !server.CanReachBlock(server.Clients[id], x, y, z) {
+			protocol.WriteSetBlock(w, x, y, z, server.ConvertBlock(server.Clients[id], currentBlock), server.Clients[id].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS))
+			w.WriteToSocket(server.Clients[id].Socket)
+			return
+		}
+
+		if (update_type == 0x01 && !allowed.CanPlace(block_type)) || (update_type != 0x01 && !allowed.CanBreak(currentBlock)) {
+			// The client has already changed the block, so it is changed back
+			protocol.WriteSetBlock(w, x, y, z, server.ConvertBlock(server.Clients[id], currentBlock), server.Clients[id].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS))
+			w.WriteToSocket(server.Clients[id].Socket)
+
+			if update_type == 0x01 {
+				server.SendChatMessage(w, id, 0xff, "You are not allowed to place block "+strconv.Itoa(int(block_type))+".")
+			} else {
+				server.SendChatMessage(w, id, 0xff, "You are not allowed to break block "+strconv.Itoa(int(currentBlock))+".")
+			}
+
+			return
+		}
+
+		if block_type == blocks.BLOCK_DIRT && server.Level.GetBlock(x, y+1, z) == blocks.BLOCK_AIR {
+			server.Level.SetBlockPlayer(x, y, z, blocks.BLOCK_GRASS, server.Clients[id].Username)
+			server.SendBlockToAllClients(w, x, y, z, blocks.BLOCK_GRASS)
+			return
+		}
+
+		server.Level.SetBlockPlayer(x, y, z, block_type, server.Clients[id].Username)
+		server.SendBlockToAllClients(w, x, y, z, block_type)
+
+		return
+	}
+
+	if packetID == protocol.CLIENT_POSITION_AND_ORIENTATION {
+		r.ReadByte() // Player ID
+
+		var x, y, z int
+
+		if server.Clients[id].SupportsExtension(protocol.EXT_ENTITY_POSITIONS) {
+			x = r.ReadInt()
+			y = r.ReadInt()
+			z = r.ReadInt()
+		} else {
+			x = r.ReadShort()
+			y = r.ReadShort()
+			z = r.ReadShort()
+		}
+
+		server.Clients[id].Yaw = r.ReadByte()
+		server.Clients[id].Pitch = r.ReadByte()
+
+		oldX, oldY, oldZ := server.Clients[id].X, server.Clients[id].Y, server.Clients[id].Z
+
+		server.Clients[id].X = x
+		server.Clients[id].Y = y
+		server.Clients[id].Z = z
+
+		server.SendMovementToAllClients(w, id, oldX, oldY, oldZ)
+
+		return
+	}
+
+	if packetID == protocol.CLIENT_MESSAGE {
+		partial := r.ReadByte() != 0x00 // LongerMessages
+		message, complete := server.ReceiveMessagePart(w, id, r.ReadString(), partial)
+
+		if !complete {
+			return
+		}
+
+		if len(message) == 0 {
+			return
+		}
+
+		if message[0] == byte('/') {
+			if !command.CanRun(server.Clients[id].Username, message) {
+				server.SendChatMessage(w, id, 0xff, "You do not have permission to use that command.")
+				return
+			}
+
+			parsedCommand := command.Parse(server.Clients[id].Username, id, message)
+
+			server.logger.Println(parsedCommand)
+
+			if parsedCommand.Name == "help" {
+				server.SendChatMessage(w, id, 0xff, "The /help command has not been implemented yet.")
+			}
+
+			if parsedCommand.Name == "announce" {
+				if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+					return
+				}
+
+				if 1 > len(parsedCommand.Arguments) {
+					server.SendChatMessage(w, id, 0xff, "You need to specify a message to announce.")
+					return
+				}
+
+				server.SendMessageTypeToAllClients(w, protocol.MESSAGE_TYPE_ANNOUNCEMENT, strings.Join(parsedCommand.Arguments, " "))
+			}
+
+			if parsedCommand.Name == "blockperms" {
+				server.BlockPermissionsCommand(w, id, parsedCommand.Arguments)
+			}
+
+			if parsedCommand.Name == "clickdistance" {
+				server.ClickDistanceCommand(w, id, parsedCommand.Arguments)
+			}
+
+			if parsedCommand.Name == "hotkey" {
+				server.HotKeyCommand(w, id, parsedCommand.Arguments)
+			}
+
+			if parsedCommand.Name == "blockinfo" {
+				if !server.Clients[id].SupportsExtension(protocol.EXT_PLAYER_CLICK) {
+					server.SendChatMessage(w, id, 0xff, "Your client does not support clicking blocks.")
+					return
+				}
+
+				server.Clients[id].BlockInfoMode = !server.Clients[id].BlockInfoMode
+
+				if server.Clients[id].BlockInfoMode {
+					server.SendChatMessage(w, id, 0xff, "Click a block to see who placed it.")
+				} else {
+					server.SendChatMessage(w, id, 0xff, "Block info disabled.")
+				}
+			}
+
+			if parsedCommand.Name == "fill" {
+				server.FillCommand(w, id, parsedCommand.Arguments)
+			}
+
+			if parsedCommand.Name == "env" {
+				server.EnvironmentCommand(w, id, parsedCommand.Arguments)
+			}
+
+			if parsedCommand.Name == "hacks" {
+				server.HacksCommand(w, id, parsedCommand.Arguments)
+			}
+
+			if parsedCommand.Name == "model" || parsedCommand.Name == "skin" {
+				server.ModelCommand(w, id, parsedCommand)
+			}
+
+			if parsedCommand.Name == "ping" {
+				playerID := id
+
+				if len(parsedCommand.Arguments) > 0 {
+					playerID = 0xff
+
+					for i := byte(0); i < byte(len(server.Clients)); i++ {
+						if server.Clients[i].Socket != nil && server.Clients[i].Username == parsedCommand.Arguments[0] {
+							playerID = i
+							break
+						}
+					}
+
+					if playerID == 0xff {
+						server.SendChatMessage(w, id, 0xff, "Failed to find a player with the name \""+parsedCommand.Arguments[0]+"\".")
+						return
+					}
+				}
+
+				server.SendChatMessage(w, id, 0xff, "Latency of "+server.Clients[playerID].Username+": "+LatencyString(server.Clients[playerID]))
+			}
+
+			if parsedCommand.Name == "setspawn" {
+				if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+					return
+				}
+
+				server.Level.Spawnpoint = level.Spawnpoint{X: server.Clients[id].X >> 5, Y: server.Clients[id].Y >> 5, Z: server.Clients[id].Z >> 5, Yaw: server.Clients[id].Yaw, Pitch: server.Clients[id].Pitch}
+				server.SendSpawnpointToAllClients(w)
+				server.SendChatMessage(w, id, 0xff, "Spawnpoint set.")
+			}
+
+			if parsedCommand.Name == "blockdef" {
+				server.BlockDefinitionCommand(w, id, parsedCommand)
+			}
+
+			if parsedCommand.Name == "kick" {
+				if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+					return
+				}
+
+				if 1 > len(parsedCommand.Arguments) {
+					server.SendChatMessage(w, id, 0xff, "You need to specify a player to kick.")
+					return
+				}
+
+				playerID := byte(0xff)
+
+				for i := byte(0); i < byte(len(server.Clients)); i++ {
+					if server.Clients[i].Username == parsedCommand.Arguments[0] {
+						playerID = i
+						break
+					}
+				}
+
+				if playerID == 0xff {
+					server.SendChatMessage(w, id, 0xff, "Failed to find a player with the name \"" + parsedCommand.Arguments[0] + "\".")
+					return
+				}
+
+				// Players can only kick players with a lower rank
+				if server.Clients[playerID].Rank.Level >= server.Clients[id].Rank.Level {
+					server.SendChatMessage(w, id, 0xff, "You can't kick "+parsedCommand.Arguments[0]+", because their rank is not lower than yours.")
+					return
+				}
+
+				message := "You have been kicked!"
+
+				if len(parsedCommand.Arguments) > 1 {
+					message = parsedCommand.Arguments[1]
+				}
+
+				protocol.WriteDisconnect(w, message)
+				w.WriteToSocket(server.Clients[playerID].Socket)
+				server.Clients[playerID].Socket.Close()
+
+				server.SendChatMessage(w, id, 0xff, parsedCommand.Arguments[0] + " has been kicked!")
+			}
+
+			return
+		}
+
+		server.logger.Println(server.Clients[id].Username + ": " + message)
+		server.SendChatToAllClients(w, id, server.Clients[id].Username+": "+message)
+		return
+	}
+}
+
+func (server *Server) HandleConnection(conn net.Conn) {
+	// Browser clients connect to the same port with WebSocket
+	if server.Config.GetBooleanDefault("websocket", false) {
+		conn.SetReadDeadline(time.Now().Add(CLIENT_TIMEOUT))
+
+		wrapped, err := websocket.Sniff(conn)
+
+		if err != nil {
+			server.logger.Println("Failed to read from", conn.RemoteAddr().String()+":", err)
+			conn.Close()
+			return
+		}
+
+		conn = wrapped
+	}
+
+	client_index := byte(0)
+	slot_assigned := false
+
+	w := packet.CreatePacketWriter()
+	queue := packet.CreateQueuedConn(conn, SEND_QUEUE_SIZE, SEND_TIMEOUT)
+
+	var packetLengths map[byte]int
+
+	server.Do(func() {
+		for i := byte(0); i < byte(len(server.Clients)); i++ {
+			if server.Clients[i].Socket == nil {
+				client_index = i
+				slot_assigned = true
+				break
+			}
+		}
+
+		if slot_assigned {
+			packetLengths = protocol.CopyClientPacketLengths()
+			// Clients get the default rank until they identify, so that packets sent before that have the fewest permissions
+			server.Clients[client_index] = Client{ID: client_index, Socket: queue, PacketLengths: packetLengths, Rank: rank.DefaultRank()}
+		}
+	})
+
+	if slot_assigned == false {
+		protocol.WriteDisconnect(&w, protocol.DISCONNECT_SERVER_FULL)
+		w.WriteToSocket(queue)
+		queue.Close()
+		server.logger.Println("Closed Connection:", conn.RemoteAddr())
+		return
+	}
+
+	// The packet lengths are only changed by packets of this client, which are handled before the next packet is read
+	framer := packet.CreatePacketFramer(conn, packetLengths)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(CLIENT_TIMEOUT))
+
+		data, err := framer.ReadPacket()
+
+		if err != nil {
+			if errors.Is(err, packet.ErrUnknownPacket) {
+				protocol.WriteDisconnect(&w, protocol.DISCONNECT_CHEAT_UNKNOWN_PACKET)
+				w.WriteToSocket(queue)
+			}
+
+			break
+		}
+
+		r := packet.CreatePacketReader(data)
+
+		server.Do(func() {
+			server.HandleMessage(&r, &w, client_index)
+		})
+
+		// The client has been disconnected (like for an invalid name or by /kick), so nothing else that it sends is handled
+		if queue.Closed() {
+			break
+		}
+	}
+
+	// Sends whatever is still queued (like the disconnect message) and closes the connection
+	queue.Close()
+
+	if queue.Overflowed() {
+		server.logger.Println("Send queue overflowed, the client was too slow:", conn.RemoteAddr())
+	}
+
+	server.Do(func() {
+		protocol.WriteDespawnPlayer(&w, client_index)
+		server.SendToAllClients(0xff, &w)
+
+		if server.Clients[client_index].Joined {
+			server.SendPlayerListRemove(&w, client_index)
+		}
+
+		server.SendChatToAllClients(&w, 0xff, server.Clients[client_index].Username+" left the game")
+
+		server.Clients[client_index] = NULL_CLIENT
+	})
+
+	server.logger.Println("Closed Connection:", conn.RemoteAddr())
+}
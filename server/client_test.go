@@ -0,0 +1,86 @@
+package server
+
+import (
+	"bytes"
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/rank"
+	"math/rand"
+	"net"
+	"testing"
+)
+
+// A socket that records every write
+type recordingConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+func (c *recordingConn) Write(data []byte) (int, error) {
+	c.writes = append(c.writes, append([]byte(nil), data...))
+	return len(data), nil
+}
+
+func TestSendLevelSingleWrite(t *testing.T) {
+	// Random blocks don't compress, so the level is split into more chunks than the send queue can hold
+	testLevel := level.GenerateLevel(256, 80, 256, level.LEVEL_FLAT, level.LEVEL_TYPE_NORMAL, nil)
+	random := rand.New(rand.NewSource(1))
+
+	for i := range testLevel.Data {
+		testLevel.Data[i] = byte(random.Intn(256))
+	}
+
+	socket := &recordingConn{}
+	server := &Server{Level: testLevel, Clients: make([]Client, MAX_CLIENTS)}
+	server.Clients[0] = Client{Socket: socket}
+
+	w := packet.CreatePacketWriter()
+	server.SendLevel(&w, 0)
+
+	if len(socket.writes) != 1 {
+		t.Fatalf("the level was sent in %d writes; want 1", len(socket.writes))
+	}
+
+	// Level Initialize (1 byte), Level Data Chunks (1028 bytes each) and Level Finalize (7 bytes)
+	data := socket.writes[0]
+	chunks := (len(data) - 1 - 7) / 1028
+
+	if chunks <= SEND_QUEUE_SIZE {
+		t.Fatalf("the level has %d chunks; the test needs more than %d", chunks, SEND_QUEUE_SIZE)
+	}
+
+	if data[0] != protocol.SERVER_LEVEL_INITIALIZE || data[1] != protocol.SERVER_LEVEL_DATA_CHUNK || data[len(data) - 7] != protocol.SERVER_LEVEL_FINALIZE {
+		t.Fatalf("unexpected level packets")
+	}
+}
+
+func TestResendLevelState(t *testing.T) {
+	server := createTestServer(t, nil)
+	server.Level.ClickDistance = 320
+	server.Level.Permissions.DeniedPlace[7] = true
+
+	socket := &recordingConn{}
+	server.Clients[0] = Client{Socket: socket, Joined: true, Extensions: map[string]int{}, Rank: rank.DefaultRank()}
+
+	for _, name := range []string{protocol.EXT_CLICK_DISTANCE, protocol.EXT_HACK_CONTROL, protocol.EXT_BLOCK_PERMISSIONS} {
+		server.Clients[0].Extensions[name] = protocol.ServerExtensionVersion(name)
+	}
+
+	w := packet.CreatePacketWriter()
+	server.ResendLevel(&w, 0)
+
+	data := bytes.Join(socket.writes, nil)
+
+	// The level state that clients reset when they load a level
+	expected := packet.CreatePacketWriter()
+	protocol.WriteClickDistance(&expected, 320)
+	protocol.WriteHackControl(&expected, server.ClientHacks(server.Clients[0]))
+	protocol.WriteSetBlockPermission(&expected, 7, false, server.ClientPermissions(server.Clients[0]).CanBreak(7), false)
+
+	for _, packetData := range [][]byte{expected.Buffer[:3], expected.Buffer[3:11], expected.Buffer[11:]} {
+		if !bytes.Contains(data, packetData) {
+			t.Errorf("the resent level doesn't contain the packet %x", packetData)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"goserver/hotkeys"
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/rank"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	CLICK_DISTANCE_TOLERANCE = 2.0 // Blocks that a client may click past its reach (the position that the server knows is a bit behind the client)
+)
+
+// The click distance of the rank overrides the click distance of the level
+func (server *Server) ClientClickDistance(client Client) int {
+	if client.Rank.ClickDistance != -1 {
+		return client.Rank.ClickDistance
+	}
+
+	return server.Level.ClickDistance
+}
+
+// Returns whether the block is close enough to the client to be clicked (clients that do not support ClickDistance always use the default reach)
+func (server *Server) CanReachBlock(client Client, x int, y int, z int) bool {
+	reach := level.DEFAULT_CLICK_DISTANCE
+
+	if client.SupportsExtension(protocol.EXT_CLICK_DISTANCE) {
+		reach = server.ClientClickDistance(client)
+	}
+
+	dx := float64(client.X) / 32 - (float64(x) + 0.5)
+	dy := float64(client.Y) / 32 - (float64(y) + 0.5)
+	dz := float64(client.Z) / 32 - (float64(z) + 0.5)
+
+	return math.Sqrt(dx * dx + dy * dy + dz * dz) <= float64(reach) / 32 + CLICK_DISTANCE_TOLERANCE
+}
+
+// The hot keys of the rank are added to the hot keys of the level
+func (server *Server) ClientHotKeys(client Client) []hotkeys.HotKey {
+	list := server.Level.HotKeys
+
+	for _, hotKey := range client.Rank.HotKeys {
+		list = hotkeys.Set(list, hotKey)
+	}
+
+	return list
+}
+
+func writeHotKey(w *packet.PacketWriter, hotKey hotkeys.HotKey) {
+	action := ""
+
+	// The newline makes the client send the action immediately
+	if len(hotKey.Action) != 0 {
+		action = hotKey.Action + "\n"
+	}
+
+	protocol.WriteSetTextHotKey(w, hotKey.Key, action, hotKey.KeyCode, hotKey.KeyMods)
+}
+
+func (server *Server) SendControls(w *packet.PacketWriter, id byte) {
+	if server.Clients[id].SupportsExtension(protocol.EXT_CLICK_DISTANCE) {
+		protocol.WriteClickDistance(w, server.ClientClickDistance(server.Clients[id]))
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_TEXT_HOT_KEY) {
+		for _, hotKey := range server.ClientHotKeys(server.Clients[id]) {
+			writeHotKey(w, hotKey)
+		}
+	}
+
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+// /clickdistance
+// /clickdistance <blocks|default>
+func (server *Server) ClickDistanceCommand(w *packet.PacketWriter, id byte, arguments []string) {
+	if len(arguments) == 0 {
+		server.SendChatMessage(w, id, 0xff, "Click distance of this level: "+strconv.FormatFloat(float64(server.Level.ClickDistance) / 32, 'f', -1, 64)+" blocks")
+		return
+	}
+
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	clickDistance := level.DEFAULT_CLICK_DISTANCE
+
+	if arguments[0] != "default" {
+		blocks, err := strconv.ParseFloat(arguments[0], 64)
+
+		if err != nil || blocks < 0 || blocks > 1023 {
+			server.SendChatMessage(w, id, 0xff, "Invalid click distance \""+arguments[0]+"\".")
+			return
+		}
+
+		clickDistance = int(blocks * 32)
+	}
+
+	server.Level.ClickDistance = clickDistance
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined || !server.Clients[i].SupportsExtension(protocol.EXT_CLICK_DISTANCE) {
+			continue
+		}
+
+		protocol.WriteClickDistance(w, server.ClientClickDistance(server.Clients[i]))
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+
+	server.SendChatMessage(w, id, 0xff, "Updated the click distance of this level.")
+}
+
+// /hotkey
+// /hotkey <key> <action|none>
+func (server *Server) HotKeyCommand(w *packet.PacketWriter, id byte, arguments []string) {
+	if len(arguments) == 0 {
+		message := "Hot keys in this level:"
+
+		for _, hotKey := range server.Level.HotKeys {
+			message += " " + hotKey.Key + "=" + hotKey.Action
+		}
+
+		server.SendChatMessage(w, id, 0xff, message)
+		return
+	}
+
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	if 2 > len(arguments) {
+		server.SendChatMessage(w, id, 0xff, "Usage: /hotkey <key> <action|none> (for example /hotkey ctrl+F5 /spawn)")
+		return
+	}
+
+	action := strings.Join(arguments[1:], " ")
+
+	if action == "none" {
+		action = ""
+	}
+
+	hotKey, ok := hotkeys.CreateHotKey(arguments[0], action)
+
+	// The action can't be longer than a string, including the newline
+	if !ok || len(action) > 63 {
+		server.SendChatMessage(w, id, 0xff, "Invalid hot key \""+arguments[0]+"\".")
+		return
+	}
+
+	server.Level.HotKeys = hotkeys.Set(server.Level.HotKeys, hotKey)
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined || !server.Clients[i].SupportsExtension(protocol.EXT_TEXT_HOT_KEY) {
+			continue
+		}
+
+		// The hot keys of the rank take priority over the hot keys of the level
+		clientHotKey := hotKey
+
+		for _, existing := range server.ClientHotKeys(server.Clients[i]) {
+			if existing.KeyCode == hotKey.KeyCode && existing.KeyMods == hotKey.KeyMods {
+				clientHotKey = existing
+			}
+		}
+
+		writeHotKey(w, clientHotKey)
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+
+	server.SendChatMessage(w, id, 0xff, "Updated the hot keys of this level.")
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/rank"
+	"strings"
+)
+
+// Sends the environment settings of the level to a client (only the extensions that the client supports)
+func (server *Server) SendEnvironment(w *packet.PacketWriter, id byte) {
+	environment := server.Level.Environment
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_ENV_COLORS) {
+		colors := []level.Color{environment.SkyColor, environment.CloudColor, environment.FogColor, environment.AmbientColor, environment.DiffuseColor}
+
+		for i, color := range colors {
+			protocol.WriteEnvColors(w, byte(protocol.ENV_COLOR_SKY + i), color.R, color.G, color.B)
+		}
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_ENV_MAP_ASPECT) {
+		protocol.WriteSetMapEnvUrl(w, environment.TexturePackURL)
+		protocol.WriteSetMapEnvProperty(w, protocol.ENV_PROPERTY_SIDE_BLOCK, int(server.ConvertBlock(server.Clients[id], environment.SideBlock)))
+		protocol.WriteSetMapEnvProperty(w, protocol.ENV_PROPERTY_EDGE_BLOCK, int(server.ConvertBlock(server.Clients[id], environment.EdgeBlock)))
+		protocol.WriteSetMapEnvProperty(w, protocol.ENV_PROPERTY_EDGE_HEIGHT, server.Level.EffectiveWaterLevel())
+		protocol.WriteSetMapEnvProperty(w, protocol.ENV_PROPERTY_CLOUDS_HEIGHT, server.Level.EffectiveCloudsHeight())
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_ENV_WEATHER_TYPE) {
+		protocol.WriteEnvWeatherType(w, environment.Weather)
+	}
+
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+func (server *Server) SendEnvironmentToAllClients(w *packet.PacketWriter) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		server.SendEnvironment(w, byte(i))
+	}
+}
+
+// /env
+// /env <property> <value>
+func (server *Server) EnvironmentCommand(w *packet.PacketWriter, id byte, arguments []string) {
+	if len(arguments) == 0 {
+		message := "Environment of this level:"
+
+		for _, property := range level.ENVIRONMENT_PROPERTIES {
+			value := server.Level.Environment.Get(property)
+
+			if len(value) == 0 {
+				value = "none"
+			}
+
+			message += " " + property + "=" + value
+		}
+
+		server.SendChatMessage(w, id, 0xff, message)
+		return
+	}
+
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	if 2 > len(arguments) {
+		server.SendChatMessage(w, id, 0xff, "Usage: /env <"+strings.Join(level.ENVIRONMENT_PROPERTIES, "|")+"> <value>")
+		return
+	}
+
+	value := strings.Join(arguments[1:], " ")
+
+	// An empty texture pack URL resets the client to the default textures
+	if arguments[0] == "texturepack" && value == "none" {
+		value = ""
+	}
+
+	if !server.Level.Environment.Set(arguments[0], value) {
+		server.SendChatMessage(w, id, 0xff, "Invalid value \""+value+"\" for \""+arguments[0]+"\".")
+		return
+	}
+
+	server.SendEnvironmentToAllClients(w)
+	server.SendChatMessage(w, id, 0xff, "Updated the environment of this level.")
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"goserver/hacks"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/rank"
+	"goserver/serialization"
+	"strconv"
+)
+
+func (server *Server) ClientHacks(client Client) hacks.Hacks {
+	return server.Level.Hacks.Or(client.Rank.Hacks)
+}
+
+// Adds the hack flags to the MOTD, cutting off the end of the MOTD if they don't fit
+func (server *Server) HacksMOTD(client Client) string {
+	motd := server.Config.GetStringDefault("motd", DEFAULT_MOTD)
+	flags := server.ClientHacks(client).MOTDFlags()
+
+	if len(flags) == 0 {
+		return motd
+	}
+
+	if len(motd) + 1 + len(flags) > serialization.STRING_LENGTH {
+		motd = motd[:serialization.STRING_LENGTH - 1 - len(flags)]
+	}
+
+	return motd + " " + flags
+}
+
+// Sends the hacks that the client is allowed to use.
+// Clients that do not support HackControl only read the MOTD flags while joining a level, so they get the server identification and the level again.
+func (server *Server) SendHacks(w *packet.PacketWriter, id byte) {
+	if server.Clients[id].SupportsExtension(protocol.EXT_HACK_CONTROL) {
+		protocol.WriteHackControl(w, server.ClientHacks(server.Clients[id]))
+		w.WriteToSocket(server.Clients[id].Socket)
+		return
+	}
+
+	protocol.WriteServerIdentification(w, server.Config.GetStringDefault("server-name", DEFAULT_SERVER_NAME), server.HacksMOTD(server.Clients[id]), false)
+	w.WriteToSocket(server.Clients[id].Socket)
+
+	server.ResendLevel(w, id)
+}
+
+// /hacks
+// /hacks <fly|noclip|speed|respawn|thirdperson> <on|off>
+// /hacks jumpheight <height|default>
+func (server *Server) HacksCommand(w *packet.PacketWriter, id byte, arguments []string) {
+	if len(arguments) == 0 {
+		message := "Hacks in this level:"
+
+		for _, name := range hacks.NAMES {
+			if *server.Level.Hacks.Get(name) {
+				message += " " + name + "=on"
+			} else {
+				message += " " + name + "=off"
+			}
+		}
+
+		if server.Level.Hacks.JumpHeight == hacks.DEFAULT_JUMP_HEIGHT {
+			message += " jumpheight=default"
+		} else {
+			message += " jumpheight=" + strconv.Itoa(server.Level.Hacks.JumpHeight)
+		}
+
+		server.SendChatMessage(w, id, 0xff, message)
+		return
+	}
+
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	usage := "Usage: /hacks <fly|noclip|speed|respawn|thirdperson|jumpheight> <value>"
+
+	if len(arguments) != 2 {
+		server.SendChatMessage(w, id, 0xff, usage)
+		return
+	}
+
+	if arguments[0] == "jumpheight" {
+		if arguments[1] == "default" {
+			server.Level.Hacks.JumpHeight = hacks.DEFAULT_JUMP_HEIGHT
+		} else {
+			jumpHeight, err := strconv.Atoi(arguments[1])
+
+			if err != nil || jumpHeight < 0 || jumpHeight > 32767 {
+				server.SendChatMessage(w, id, 0xff, "Invalid jump height \""+arguments[1]+"\".")
+				return
+			}
+
+			server.Level.Hacks.JumpHeight = jumpHeight
+		}
+	} else {
+		hack := server.Level.Hacks.Get(arguments[0])
+
+		if hack == nil || (arguments[1] != "on" && arguments[1] != "off") {
+			server.SendChatMessage(w, id, 0xff, usage)
+			return
+		}
+
+		*hack = arguments[1] == "on"
+	}
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		server.SendHacks(w, byte(i))
+	}
+
+	server.SendChatMessage(w, id, 0xff, "Updated the hacks of this level.")
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"crypto/rand"
+	"errors"
+	"goserver/protocol"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_HEARTBEAT_URL = "http://www.classicube.net/server/heartbeat/"
+	HEARTBEAT_INTERVAL = time.Second * 45
+	HEARTBEAT_TIMEOUT = time.Second * 10
+	HEARTBEAT_MIN_BACKOFF = time.Second * 5 // Retry delay after the first failed heartbeat, doubled after every failure
+	HEARTBEAT_MAX_BACKOFF = time.Minute * 5
+
+	SALT_LENGTH = 16
+	SALT_CHARACTERS = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// Random string that is sent with the heartbeat, and used to verify usernames. A new one is generated every time the server starts.
+func GenerateSalt() (string, error) {
+	salt := make([]byte, SALT_LENGTH)
+
+	for i := 0; i < len(salt); i++ {
+		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(SALT_CHARACTERS))))
+
+		if err != nil {
+			return "", err
+		}
+
+		salt[i] = SALT_CHARACTERS[index.Int64()]
+	}
+
+	return string(salt), nil
+}
+
+func (server *Server) JoinedClientCount() int {
+	count := 0
+
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket != nil && server.Clients[i].Joined {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Returns the number of players that can be on the server at once (max-players, but at most the number of client slots)
+func (server *Server) MaxPlayers() int {
+	maxPlayers := server.Config.GetNumberDefault("max-players", len(server.Clients))
+
+	if maxPlayers > len(server.Clients) {
+		return len(server.Clients)
+	}
+
+	return maxPlayers
+}
+
+// Returns the URL that heartbeats are sent to, or a blank string if the heartbeat is disabled.
+// The heartbeat is only sent if heartbeat-url is set, or if the server is public (which uses the default URL).
+func (server *Server) HeartbeatURL() string {
+	if heartbeatURL := server.Config.GetStringDefault("heartbeat-url", ""); len(heartbeatURL) != 0 {
+		return heartbeatURL
+	}
+
+	if server.Config.GetBooleanDefault("public", false) {
+		return DEFAULT_HEARTBEAT_URL
+	}
+
+	return ""
+}
+
+func (server *Server) HeartbeatParameters() url.Values {
+	parameters := url.Values{}
+
+	parameters.Set("name", server.Config.GetStringDefault("server-name", DEFAULT_SERVER_NAME))
+	parameters.Set("port", server.Config.GetStringDefault("port", DEFAULT_PORT))
+	parameters.Set("users", strconv.Itoa(server.JoinedClientCount()))
+	parameters.Set("max", strconv.Itoa(server.MaxPlayers()))
+	parameters.Set("public", strconv.FormatBool(server.Config.GetBooleanDefault("public", false)))
+	parameters.Set("salt", server.Salt)
+	parameters.Set("version", strconv.Itoa(protocol.PROTOCOL_VERSION))
+	parameters.Set("software", protocol.CPE_APP_NAME)
+	parameters.Set("web", strconv.FormatBool(server.Config.GetBooleanDefault("websocket", false)))
+
+	return parameters
+}
+
+// Sends a heartbeat and returns the play URL of the server
+func SendHeartbeat(heartbeatURL string, parameters url.Values) (string, error) {
+	client := http.Client{Timeout: HEARTBEAT_TIMEOUT}
+	response, err := client.PostForm(heartbeatURL, parameters)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return "", err
+	}
+
+	playURL := strings.TrimSpace(string(body))
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.New("heartbeat server returned " + response.Status + ": " + playURL)
+	}
+
+	// Errors are returned as text instead of a URL
+	if !strings.HasPrefix(playURL, "http://") && !strings.HasPrefix(playURL, "https://") {
+		return "", errors.New("heartbeat server returned an error: " + playURL)
+	}
+
+	return playURL, nil
+}
+
+// Returns the retry delay after another failed heartbeat
+func NextHeartbeatBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+
+	if backoff > HEARTBEAT_MAX_BACKOFF {
+		return HEARTBEAT_MAX_BACKOFF
+	}
+
+	return backoff
+}
+
+// Announces the server to the heartbeat URL, retrying failed heartbeats with backoff
+func (server *Server) HeartbeatThread(heartbeatURL string) {
+	lastPlayURL := ""
+	backoff := HEARTBEAT_MIN_BACKOFF
+
+	for {
+		var parameters url.Values
+
+		if !server.Do(func() {
+			parameters = server.HeartbeatParameters()
+		}) {
+			return
+		}
+
+		playURL, err := SendHeartbeat(heartbeatURL, parameters)
+
+		if err != nil {
+			server.logger.Println("Heartbeat failed, retrying in", backoff.String()+":", err)
+			if !server.sleep(backoff) {
+				return
+			}
+
+			backoff = NextHeartbeatBackoff(backoff)
+			continue
+		}
+
+		backoff = HEARTBEAT_MIN_BACKOFF
+
+		if playURL != lastPlayURL {
+			server.logger.Println("Server URL:", playURL)
+			lastPlayURL = playURL
+		}
+
+		if !server.sleep(HEARTBEAT_INTERVAL) {
+			return
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"goserver/config"
+	"goserver/protocol"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatURL(t *testing.T) {
+	tests := []struct {
+		properties map[string]string
+		heartbeatURL string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"heartbeat-url": ""}, ""},
+		{map[string]string{"public": "true"}, DEFAULT_HEARTBEAT_URL},
+		{map[string]string{"public": "true", "heartbeat-url": ""}, DEFAULT_HEARTBEAT_URL},
+		{map[string]string{"heartbeat-url": "http://localhost/heartbeat"}, "http://localhost/heartbeat"},
+		{map[string]string{"public": "true", "heartbeat-url": "http://localhost/heartbeat"}, "http://localhost/heartbeat"},
+	}
+
+	for _, test := range tests {
+		server := &Server{Config: testConfig(test.properties)}
+
+		if heartbeatURL := server.HeartbeatURL(); heartbeatURL != test.heartbeatURL {
+			t.Errorf("%v: HeartbeatURL = %q; want %q", test.properties, heartbeatURL, test.heartbeatURL)
+		}
+	}
+}
+
+func TestDefaultConfigHeartbeat(t *testing.T) {
+	defaultConfig, err := config.ParseConfig(DEFAULT_CONFIG)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &Server{Config: defaultConfig}
+
+	if heartbeatURL := server.HeartbeatURL(); heartbeatURL != "" {
+		t.Fatalf("the default config sends heartbeats to %q", heartbeatURL)
+	}
+}
+
+func TestHeartbeatParameters(t *testing.T) {
+	server := &Server{
+		Config: testConfig(map[string]string{"public": "true", "websocket": "true"}),
+		Clients: make([]Client, MAX_CLIENTS),
+		Salt: "abcdefghijklmnop",
+	}
+
+	server.Clients[0] = Client{Socket: &net.TCPConn{}, Joined: true}
+	server.Clients[1] = Client{Socket: &net.TCPConn{}} // Still identifying
+
+	parameters := server.HeartbeatParameters()
+	expected := map[string]string{
+		"name": "Test Server",
+		"port": "25565",
+		"users": "1",
+		"max": "8",
+		"public": "true",
+		"salt": "abcdefghijklmnop",
+		"version": "7",
+		"software": protocol.CPE_APP_NAME,
+		"web": "true",
+	}
+
+	for key, value := range expected {
+		if parameters.Get(key) != value {
+			t.Errorf("%s = %q; want %q", key, parameters.Get(key), value)
+		}
+	}
+}
+
+func TestHeartbeatMaxPlayers(t *testing.T) {
+	// max-players can't be higher than the number of client slots
+	server := &Server{Config: testConfig(map[string]string{"max-players": "1000"}), Clients: make([]Client, MAX_CLIENTS)}
+
+	if maxPlayers := server.HeartbeatParameters().Get("max"); maxPlayers != strconv.Itoa(MAX_CLIENTS) {
+		t.Fatalf("max = %q; want %d", maxPlayers, MAX_CLIENTS)
+	}
+}
+
+func TestSendHeartbeat(t *testing.T) {
+	var received url.Values
+
+	heartbeatServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ParseForm() != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received = r.PostForm
+		w.Write([]byte("  http://www.classicube.net/server/play/0123456789abcdef/\r\n"))
+	}))
+
+	defer heartbeatServer.Close()
+
+	parameters := url.Values{"name": {"Test Server"}, "salt": {"abc"}}
+	playURL, err := SendHeartbeat(heartbeatServer.URL, parameters)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if playURL != "http://www.classicube.net/server/play/0123456789abcdef/" {
+		t.Fatalf("play URL = %q", playURL)
+	}
+
+	if received.Get("name") != "Test Server" || received.Get("salt") != "abc" {
+		t.Fatalf("received parameters %v", received)
+	}
+}
+
+func TestSendHeartbeatErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body string
+	}{
+		{http.StatusOK, "Invalid salt"},
+		{http.StatusOK, ""},
+		{http.StatusOK, "ftp://www.classicube.net/server/play/abc/"},
+		{http.StatusInternalServerError, "http://www.classicube.net/server/play/abc/"},
+		{http.StatusNotFound, "Not found"},
+	}
+
+	for _, test := range tests {
+		heartbeatServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			w.Write([]byte(test.body))
+		}))
+
+		playURL, err := SendHeartbeat(heartbeatServer.URL, url.Values{})
+		heartbeatServer.Close()
+
+		if err == nil {
+			t.Errorf("%d %q: play URL %q; want an error", test.status, test.body, playURL)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.body) {
+			t.Errorf("%d %q: the error %q doesn't contain the body", test.status, test.body, err)
+		}
+	}
+}
+
+func TestSendHeartbeatUnreachable(t *testing.T) {
+	heartbeatServer := httptest.NewServer(http.NotFoundHandler())
+	heartbeatURL := heartbeatServer.URL
+	heartbeatServer.Close()
+
+	if _, err := SendHeartbeat(heartbeatURL, url.Values{}); err == nil {
+		t.Fatal("heartbeat to a closed server succeeded")
+	}
+}
+
+func TestNextHeartbeatBackoff(t *testing.T) {
+	expected := []time.Duration{
+		time.Second * 10,
+		time.Second * 20,
+		time.Second * 40,
+		time.Second * 80,
+		time.Second * 160,
+		HEARTBEAT_MAX_BACKOFF,
+		HEARTBEAT_MAX_BACKOFF,
+	}
+
+	backoff := HEARTBEAT_MIN_BACKOFF
+
+	for i, want := range expected {
+		backoff = NextHeartbeatBackoff(backoff)
+
+		if backoff != want {
+			t.Fatalf("backoff after %d failures = %v; want %v", i + 2, backoff, want)
+		}
+	}
+}
+
+func TestHeartbeatThread(t *testing.T) {
+	requests := make(chan url.Values, 1)
+
+	heartbeatServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		select {
+		case requests <- r.PostForm:
+		default:
+		}
+
+		w.Write([]byte("http://www.classicube.net/server/play/abc/"))
+	}))
+
+	defer heartbeatServer.Close()
+
+	server := createTestServer(t, map[string]string{"heartbeat-url": heartbeatServer.URL})
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case parameters := <-requests:
+		if parameters.Get("salt") != server.Salt || parameters.Get("users") != "0" {
+			t.Errorf("received parameters %v", parameters)
+		}
+	case <-time.After(time.Second * 5):
+		t.Error("no heartbeat was sent")
+	}
+
+	// The heartbeat thread is waiting for the next heartbeat, and has to stop when the server shuts down
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 5)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
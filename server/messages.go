@@ -0,0 +1,117 @@
+package server
+
+import (
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/serialization"
+)
+
+const (
+	MAX_MESSAGE_LENGTH = 1024 // Maximum length of a message sent in multiple parts (LongerMessages)
+)
+
+func IsChatMessageType(messageType byte) bool {
+	return messageType == protocol.MESSAGE_TYPE_CHAT
+}
+
+func IsAnnouncementMessageType(messageType byte) bool {
+	return messageType >= protocol.MESSAGE_TYPE_ANNOUNCEMENT && messageType <= protocol.MESSAGE_TYPE_SMALL_ANNOUNCEMENT
+}
+
+// Sends a chat message to the client. source is the ID of the player that sent the message (or 0xff for server messages).
+func (server *Server) SendChatMessage(w *packet.PacketWriter, id byte, source byte, message string) {
+	for _, line := range protocol.WrapMessage(message) {
+		if server.Clients[id].SupportsExtension(protocol.EXT_MESSAGE_TYPES) {
+			// Clients that support MessageTypes use the player ID byte as the message type
+			protocol.WriteMessage(w, protocol.MESSAGE_TYPE_CHAT, line)
+		} else {
+			protocol.WriteMessage(w, source, line)
+		}
+	}
+
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+func (server *Server) SendChatToAllClients(w *packet.PacketWriter, source byte, message string) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil {
+			continue
+		}
+
+		server.SendChatMessage(w, byte(i), source, message)
+	}
+}
+
+// Shows the message in a CPE message slot (status lines, bottom right lines and announcements).
+// Clients that do not support MessageTypes get the message in chat instead. Status and bottom right lines are only sent to chat when they change, so that persistent text is not repeated.
+func (server *Server) SendMessageType(w *packet.PacketWriter, id byte, messageType byte, message string) {
+	if IsChatMessageType(messageType) {
+		server.SendChatMessage(w, id, 0xff, message)
+		return
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_MESSAGE_TYPES) {
+		protocol.WriteMessage(w, messageType, message)
+		w.WriteToSocket(server.Clients[id].Socket)
+		return
+	}
+
+	if !IsAnnouncementMessageType(messageType) {
+		if server.Clients[id].MessageSlots == nil {
+			server.Clients[id].MessageSlots = make(map[byte]string)
+		}
+
+		if server.Clients[id].MessageSlots[messageType] == message {
+			return
+		}
+
+		server.Clients[id].MessageSlots[messageType] = message
+	}
+
+	if len(message) == 0 {
+		return
+	}
+
+	server.SendChatMessage(w, id, 0xff, message)
+}
+
+func (server *Server) SendMessageTypeToAllClients(w *packet.PacketWriter, messageType byte, message string) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		server.SendMessageType(w, byte(i), messageType, message)
+	}
+}
+
+// Adds a part of a message to the client's partial message. Returns the complete message once the final part has been received.
+func (server *Server) ReceiveMessagePart(w *packet.PacketWriter, id byte, message string, partial bool) (string, bool) {
+	if !server.Clients[id].SupportsExtension(protocol.EXT_LONGER_MESSAGES) {
+		return message, true
+	}
+
+	if partial && len(message) < serialization.STRING_LENGTH {
+		// Trailing spaces are removed when the string is decoded, so the space between this part and the next part needs to be added back
+		message += " "
+	}
+
+	message = server.Clients[id].PartialMessage + message
+
+	if len(message) > MAX_MESSAGE_LENGTH {
+		if len(server.Clients[id].PartialMessage) < MAX_MESSAGE_LENGTH {
+			server.SendChatMessage(w, id, 0xff, "&cYour message is too long, so it has been cut off.")
+		}
+
+		message = message[:MAX_MESSAGE_LENGTH]
+	}
+
+	if partial {
+		server.Clients[id].PartialMessage = message
+		return "", false
+	}
+
+	server.Clients[id].PartialMessage = ""
+
+	return message, true
+}
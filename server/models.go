@@ -0,0 +1,226 @@
+package server
+
+import (
+	"errors"
+	"goserver/command"
+	"goserver/config"
+	"goserver/packet"
+	"goserver/protocol"
+	"goserver/rank"
+	"goserver/serialization"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	MODELS_FILE = "models.properties" // username.model=model, username.skin=skin
+
+	DEFAULT_MODEL = "humanoid"
+	MAX_MODEL_SCALE = 3.0
+)
+
+var MODEL_NAMES = []string{"humanoid", "chibi", "head", "sit", "giant", "corpse", "chicken", "creeper", "pig", "sheep", "sheep_nofur", "skeleton", "spider", "zombie"}
+
+func (server *Server) LoadPlayerModels() error {
+	if _, err := os.Stat(server.Path(MODELS_FILE)); errors.Is(err, os.ErrNotExist) {
+		server.PlayerModels = config.Config{Data: make(map[string]string)}
+		return nil
+	}
+
+	server.logger.Println("Reading " + MODELS_FILE + "...")
+
+	content, err := ioutil.ReadFile(server.Path(MODELS_FILE))
+
+	if err != nil {
+		return err
+	}
+
+	server.PlayerModels, err = config.ParseConfig(string(content))
+
+	if err != nil {
+		return errors.New("failed to parse " + MODELS_FILE + ": " + err.Error())
+	}
+
+	return nil
+}
+
+// Saves models.properties in the background (this must be called from the server goroutine)
+func (server *Server) SavePlayerModels() {
+	server.QueueFileWrite(MODELS_FILE, []byte(server.PlayerModels.Serialize()))
+	server.writeQueuedFilesLater()
+}
+
+// Returns the saved model of the player, or the default model
+func (server *Server) GetPlayerModel(username string) string {
+	return server.PlayerModels.GetStringDefault(username + ".model", DEFAULT_MODEL)
+}
+
+// Returns the saved skin of the player, or the username (clients download the skin of that player)
+func (server *Server) GetPlayerSkin(username string) string {
+	return server.PlayerModels.GetStringDefault(username + ".skin", username)
+}
+
+// A model is a model name or a block ID, optionally followed by "|" and a scale
+func ValidModel(model string) bool {
+	parsedModel := strings.SplitN(model, "|", 2)
+
+	if len(parsedModel) == 2 {
+		scale, err := strconv.ParseFloat(parsedModel[1], 32)
+
+		if err != nil || scale <= 0 || scale > MAX_MODEL_SCALE {
+			return false
+		}
+	}
+
+	if _, ok := parseBlock(parsedModel[0]); ok {
+		return true
+	}
+
+	for _, name := range MODEL_NAMES {
+		if parsedModel[0] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Skins are usernames or URLs, which are sent as a string field and saved in models.properties
+func ValidSkin(skin string) bool {
+	return len(skin) <= serialization.STRING_LENGTH && printableText(skin)
+}
+
+// Usernames are the keys of models.properties, so they can't contain "=" (or start a comment)
+func validModelsUsername(username string) bool {
+	return printableText(username) && !strings.Contains(username, "=") && !strings.HasPrefix(username, "#")
+}
+
+// Returns whether the text is not empty and only contains printable ASCII characters other than spaces (so it fits on a line of a properties file)
+func printableText(text string) bool {
+	if len(text) == 0 {
+		return false
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] <= ' ' || text[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Block models are shown as the block that the viewer is shown instead of the block
+func (server *Server) ViewerModel(viewer Client, model string) string {
+	parsedModel := strings.SplitN(model, "|", 2)
+	block, ok := parseBlock(parsedModel[0])
+
+	if !ok {
+		return model
+	}
+
+	parsedModel[0] = strconv.Itoa(int(server.ConvertBlock(viewer, block)))
+
+	return strings.Join(parsedModel, "|")
+}
+
+// Changes the model of the client for every client that supports ChangeModel (including the client itself)
+func (server *Server) SendModelToAllClients(w *packet.PacketWriter, id byte) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined || !server.Clients[i].SupportsExtension(protocol.EXT_CHANGE_MODEL) {
+			continue
+		}
+
+		entityID := id
+
+		if i == int(id) {
+			entityID = 0xff
+		}
+
+		protocol.WriteChangeModel(w, entityID, server.ViewerModel(server.Clients[i], server.Clients[id].Model))
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+// Clients only read skins when an entity is spawned, so the client is spawned again for every client (including the client itself)
+func (server *Server) RespawnClientForAllClients(w *packet.PacketWriter, id byte) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		entityID := id
+
+		if i == int(id) {
+			entityID = 0xff
+		}
+
+		protocol.WriteDespawnPlayer(w, entityID)
+		server.WriteSpawnClient(w, server.Clients[i], server.Clients[id], entityID, server.Clients[id].X, server.Clients[id].Y, server.Clients[id].Z, server.Clients[id].Yaw, server.Clients[id].Pitch)
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
+
+// /model <player> <model|default>
+// /skin <player> <skin|default>
+func (server *Server) ModelCommand(w *packet.PacketWriter, id byte, parsedCommand command.Command) {
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	arguments := parsedCommand.Arguments
+
+	if len(arguments) != 2 {
+		server.SendChatMessage(w, id, 0xff, "Usage: /"+parsedCommand.Name+" <player> <"+parsedCommand.Name+"|default>")
+		return
+	}
+
+	playerID := byte(0xff)
+
+	for i := byte(0); i < byte(len(server.Clients)); i++ {
+		if server.Clients[i].Socket != nil && server.Clients[i].Joined && server.Clients[i].Username == arguments[0] {
+			playerID = i
+			break
+		}
+	}
+
+	if playerID == 0xff {
+		server.SendChatMessage(w, id, 0xff, "Failed to find a player with the name \""+arguments[0]+"\".")
+		return
+	}
+
+	username := server.Clients[playerID].Username
+	key := username + "." + parsedCommand.Name
+	value := arguments[1]
+
+	if !validModelsUsername(username) {
+		server.SendChatMessage(w, id, 0xff, "The "+parsedCommand.Name+" of "+username+" can't be saved, because the name contains invalid characters.")
+		return
+	}
+
+	if value == "default" {
+		delete(server.PlayerModels.Data, key)
+	} else if parsedCommand.Name == "model" && !ValidModel(value) {
+		server.SendChatMessage(w, id, 0xff, "Invalid model \""+value+"\".")
+		return
+	} else if parsedCommand.Name == "skin" && !ValidSkin(value) {
+		server.SendChatMessage(w, id, 0xff, "Invalid skin \""+value+"\".")
+		return
+	} else {
+		server.PlayerModels.Data[key] = value
+	}
+
+	server.SavePlayerModels()
+
+	if parsedCommand.Name == "model" {
+		server.Clients[playerID].Model = server.GetPlayerModel(username)
+		server.SendModelToAllClients(w, playerID)
+	} else {
+		server.Clients[playerID].Skin = server.GetPlayerSkin(username)
+		server.RespawnClientForAllClients(w, playerID)
+	}
+
+	server.SendChatMessage(w, id, 0xff, "Changed the "+parsedCommand.Name+" of "+username+".")
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"goserver/blocks"
+	"goserver/packet"
+	"goserver/permissions"
+	"goserver/protocol"
+	"goserver/rank"
+	"strconv"
+)
+
+// Default hotbar of the client, blocks that the client can't place are removed from it
+var DEFAULT_HOTBAR = []uint16{
+	blocks.BLOCK_STONE,
+	blocks.BLOCK_COBBLESTONE,
+	blocks.BLOCK_BRICKS,
+	blocks.BLOCK_DIRT,
+	blocks.BLOCK_PLANKS,
+	blocks.BLOCK_WOOD,
+	blocks.BLOCK_LEAVES,
+	blocks.BLOCK_GLASS,
+	blocks.BLOCK_SLAB,
+}
+
+// Blocks are only allowed if both the level and the rank of the client allow them
+func (server *Server) ClientPermissions(client Client) permissions.Permissions {
+	return server.Level.Permissions.And(client.Rank.Permissions)
+}
+
+// Returns the blocks that the client can have in its inventory
+func (server *Server) KnownBlocks(client Client) []uint16 {
+	known := make([]uint16, 0)
+
+	for i := 1; i < blocks.BLOCK_COUNT; i++ {
+		id := uint16(i)
+		_, defined := server.GetBlockDefinition(id)
+
+		if id <= blocks.BLOCK_MAX_CLASSIC || (client.CustomBlocksLevel != 0 && id <= blocks.BLOCK_MAX_CUSTOM_BLOCKS) {
+			known = append(known, id)
+		} else if defined && server.CanPlaceBlock(client, id) {
+			known = append(known, id)
+		}
+	}
+
+	return known
+}
+
+// Sends the blocks that the client is allowed to place and break.
+// Blocks that the client can't place are hidden from the inventory and the hotbar.
+func (server *Server) SendPermissions(w *packet.PacketWriter, id byte) {
+	allowed := server.ClientPermissions(server.Clients[id])
+	extBlocks := server.Clients[id].SupportsExtension(protocol.EXT_EXTENDED_BLOCKS)
+
+	for _, block := range server.KnownBlocks(server.Clients[id]) {
+		if server.Clients[id].SupportsExtension(protocol.EXT_BLOCK_PERMISSIONS) {
+			protocol.WriteSetBlockPermission(w, block, allowed.CanPlace(block), allowed.CanBreak(block), extBlocks)
+		}
+
+		if server.Clients[id].SupportsExtension(protocol.EXT_INVENTORY_ORDER) {
+			order := block
+
+			if !allowed.CanPlace(block) {
+				order = 0
+			}
+
+			protocol.WriteSetInventoryOrder(w, block, order, extBlocks)
+		}
+	}
+
+	if server.Clients[id].SupportsExtension(protocol.EXT_SET_HOTBAR) {
+		for i, block := range DEFAULT_HOTBAR {
+			if !allowed.CanPlace(block) {
+				block = blocks.BLOCK_AIR
+			}
+
+			protocol.WriteSetHotbar(w, block, byte(i), extBlocks)
+		}
+	}
+
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+func (server *Server) SendPermissionsToAllClients(w *packet.PacketWriter) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		server.SendPermissions(w, byte(i))
+	}
+}
+
+// /blockperms
+// /blockperms <place|break> <allow|deny> <block>
+func (server *Server) BlockPermissionsCommand(w *packet.PacketWriter, id byte, arguments []string) {
+	if len(arguments) == 0 {
+		message := "Blocks that can't be placed in this level: " + permissions.FormatBlocks(server.Level.Permissions.DeniedPlace)
+		message += " Blocks that can't be broken in this level: " + permissions.FormatBlocks(server.Level.Permissions.DeniedBreak)
+
+		server.SendChatMessage(w, id, 0xff, message)
+		return
+	}
+
+	if !server.RequireRank(w, id, rank.OPERATOR_LEVEL) {
+		return
+	}
+
+	usage := "Usage: /blockperms <place|break> <allow|deny> <block>"
+
+	if len(arguments) != 3 {
+		server.SendChatMessage(w, id, 0xff, usage)
+		return
+	}
+
+	denied := server.Level.Permissions.Get(arguments[0])
+
+	if denied == nil || (arguments[1] != "allow" && arguments[1] != "deny") {
+		server.SendChatMessage(w, id, 0xff, usage)
+		return
+	}
+
+	block, ok := parseBlock(arguments[2])
+
+	if !ok || block == blocks.BLOCK_AIR {
+		server.SendChatMessage(w, id, 0xff, "Invalid block \""+arguments[2]+"\".")
+		return
+	}
+
+	if arguments[1] == "deny" {
+		denied[block] = true
+	} else {
+		delete(denied, block)
+	}
+
+	server.SendPermissionsToAllClients(w)
+	server.SendChatMessage(w, id, 0xff, "Updated the block permissions of this level ("+arguments[0]+" "+strconv.Itoa(int(block))+": "+arguments[1]+").")
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"goserver/packet"
+	"goserver/protocol"
+	"time"
+)
+
+const (
+	PING_INTERVAL = time.Second * 5
+	CLIENT_TIMEOUT = time.Second * 60 // Clients that don't send anything for this long are disconnected
+	SEND_QUEUE_SIZE = 4096 // Packet writes that can be queued for a client before it is disconnected
+	SEND_TIMEOUT = time.Second * 10 // Clients that don't receive a queued write within this time are disconnected
+)
+
+// Pings every client, so that dead connections are noticed and latency can be measured (TwoWayPing)
+func (server *Server) PingThread() {
+	w := packet.CreatePacketWriter()
+
+	for server.sleep(PING_INTERVAL) {
+		server.Do(func() {
+			for i := 0; i < len(server.Clients); i++ {
+				if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+					continue
+				}
+
+				if server.Clients[i].SupportsExtension(protocol.EXT_TWO_WAY_PING) {
+					server.Clients[i].PingData = (server.Clients[i].PingData + 1) & 0x7fff
+					server.Clients[i].PingSent = time.Now()
+					protocol.WriteTwoWayPing(&w, protocol.PING_FROM_SERVER, server.Clients[i].PingData)
+				} else {
+					protocol.WritePing(&w)
+				}
+
+				w.WriteToSocket(server.Clients[i].Socket)
+			}
+		})
+	}
+}
+
+func (server *Server) HandleTwoWayPing(r *packet.PacketReader, w *packet.PacketWriter, id byte) {
+	if !server.Clients[id].SupportsExtension(protocol.EXT_TWO_WAY_PING) {
+		return
+	}
+
+	direction := r.ReadByte()
+	data := r.ReadShort()
+
+	if direction == protocol.PING_FROM_CLIENT {
+		// Send the ping back to the client
+
+		protocol.WriteTwoWayPing(w, protocol.PING_FROM_CLIENT, data)
+		w.WriteToSocket(server.Clients[id].Socket)
+		return
+	}
+
+	if data == server.Clients[id].PingData && !server.Clients[id].PingSent.IsZero() {
+		server.Clients[id].Latency = time.Since(server.Clients[id].PingSent)
+		server.Clients[id].PingSent = time.Time{}
+	}
+}
+
+// Returns the latency as text for commands (the latency can only be measured for clients that support TwoWayPing)
+func LatencyString(client Client) string {
+	if !client.SupportsExtension(protocol.EXT_TWO_WAY_PING) {
+		return "unknown"
+	}
+
+	if client.Latency == 0 {
+		return "not measured yet"
+	}
+
+	return client.Latency.Round(time.Millisecond).String()
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"goserver/packet"
+	"goserver/protocol"
+)
+
+func ListName(client Client) string {
+	return client.Rank.Color + client.Username
+}
+
+// Spawns the target client for the viewer (ExtAddEntity2 lets the entity name differ from the list name, and sets the skin)
+func (server *Server) WriteSpawnClient(w *packet.PacketWriter, viewer Client, target Client, entityID byte, x int, y int, z int, yaw byte, pitch byte) {
+	extPositions := viewer.SupportsExtension(protocol.EXT_ENTITY_POSITIONS)
+
+	if viewer.SupportsExtension(protocol.EXT_PLAYER_LIST) {
+		protocol.WriteExtAddEntity2(w, entityID, target.DisplayName, target.Skin, x, y, z, yaw, pitch, extPositions)
+	} else {
+		protocol.WriteSpawnPlayer(w, target.DisplayName, entityID, x, y, z, yaw, pitch, extPositions)
+	}
+
+	if viewer.SupportsExtension(protocol.EXT_CHANGE_MODEL) && target.Model != DEFAULT_MODEL {
+		protocol.WriteChangeModel(w, entityID, server.ViewerModel(viewer, target.Model))
+	}
+}
+
+func WritePlayerListEntry(w *packet.PacketWriter, client Client) {
+	protocol.WriteExtAddPlayerName(w, client.ID, client.Username, ListName(client), client.Rank.Name, client.Rank.Level)
+}
+
+// Adds the client to the player list of every client, and sends the current player list to the client
+func (server *Server) SendPlayerListAdd(w *packet.PacketWriter, id byte) {
+	for i := 0; i < len(server.Clients); i++ {
+		if server.Clients[i].Socket == nil || !server.Clients[i].Joined {
+			continue
+		}
+
+		if server.Clients[id].SupportsExtension(protocol.EXT_PLAYER_LIST) {
+			WritePlayerListEntry(w, server.Clients[i])
+			w.WriteToSocket(server.Clients[id].Socket)
+		}
+
+		if i != int(id) && server.Clients[i].SupportsExtension(protocol.EXT_PLAYER_LIST) {
+			WritePlayerListEntry(w, server.Clients[id])
+			w.WriteToSocket(server.Clients[i].Socket)
+		}
+	}
+}
+
+func (server *Server) SendPlayerListRemove(w *packet.PacketWriter, id byte) {
+	for i := 0; i < len(server.Clients); i++ {
+		if i == int(id) || server.Clients[i].Socket == nil || !server.Clients[i].SupportsExtension(protocol.EXT_PLAYER_LIST) {
+			continue
+		}
+
+		protocol.WriteExtRemovePlayerName(w, id)
+		w.WriteToSocket(server.Clients[i].Socket)
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"errors"
+	"goserver/config"
+	"goserver/packet"
+	"goserver/rank"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	RANKS_FILE = "ranks.properties" // username=rank
+)
+
+func (server *Server) LoadPlayerRanks() error {
+	if _, err := os.Stat(server.Path(RANKS_FILE)); errors.Is(err, os.ErrNotExist) {
+		server.PlayerRanks = config.Config{Data: make(map[string]string)}
+		return nil
+	}
+
+	server.logger.Println("Reading " + RANKS_FILE + "...")
+
+	content, err := ioutil.ReadFile(server.Path(RANKS_FILE))
+
+	if err != nil {
+		return err
+	}
+
+	server.PlayerRanks, err = config.ParseConfig(string(content))
+
+	if err != nil {
+		return errors.New("failed to parse " + RANKS_FILE + ": " + err.Error())
+	}
+
+	return nil
+}
+
+func (server *Server) GetPlayerRank(username string) rank.Rank {
+	rankName, err := server.PlayerRanks.GetString(username)
+
+	if err != nil {
+		return rank.DefaultRank()
+	}
+
+	playerRank, exists := rank.GetRank(rankName)
+
+	if !exists {
+		server.logger.Println("Player", username, "has an invalid rank in "+RANKS_FILE+":", rankName)
+		return rank.DefaultRank()
+	}
+
+	return playerRank
+}
+
+// Tells the client that it isn't allowed to use the command if its rank is lower than the level
+func (server *Server) RequireRank(w *packet.PacketWriter, id byte, level byte) bool {
+	if server.Clients[id].Rank.Level >= level {
+		return true
+	}
+
+	server.SendChatMessage(w, id, 0xff, "You need to be "+rank.LevelName(level)+" or higher to use this command.")
+	return false
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"goserver/packet"
+	"goserver/protocol"
+)
+
+const (
+	SELECTION_ID_FILL = 0xff // Area that a pending /fill will change
+)
+
+// A translucent box drawn by the client (SelectionCuboid).
+// The coordinates are block coordinates, and both corners are inside the box.
+// Selections are stored in the client slot, so resetting the slot on disconnect removes them (the client removes its own copy when it closes).
+type Selection struct {
+	Label   string
+	MinX    int
+	MinY    int
+	MinZ    int
+	MaxX    int
+	MaxY    int
+	MaxZ    int
+	R       int
+	G       int
+	B       int
+	Opacity int
+}
+
+func writeSelection(w *packet.PacketWriter, selectionID byte, selection Selection) {
+	protocol.WriteMakeSelection(w, selectionID, selection.Label, selection.MinX, selection.MinY, selection.MinZ, selection.MaxX+1, selection.MaxY+1, selection.MaxZ+1, selection.R, selection.G, selection.B, selection.Opacity)
+}
+
+// Shows a selection to a client, replacing the selection with the same ID.
+// Returns false if the client does not support SelectionCuboid.
+func (server *Server) ShowSelection(w *packet.PacketWriter, id byte, selectionID byte, selection Selection) bool {
+	if !server.Clients[id].SupportsExtension(protocol.EXT_SELECTION_CUBOID) {
+		return false
+	}
+
+	if server.Clients[id].Selections == nil {
+		server.Clients[id].Selections = make(map[byte]Selection)
+	}
+
+	server.Clients[id].Selections[selectionID] = selection
+
+	writeSelection(w, selectionID, selection)
+	w.WriteToSocket(server.Clients[id].Socket)
+
+	return true
+}
+
+func (server *Server) HideSelection(w *packet.PacketWriter, id byte, selectionID byte) {
+	if _, exists := server.Clients[id].Selections[selectionID]; !exists {
+		return
+	}
+
+	delete(server.Clients[id].Selections, selectionID)
+
+	protocol.WriteRemoveSelection(w, selectionID)
+	w.WriteToSocket(server.Clients[id].Socket)
+}
+
+// Clients remove all selections when they load a level, so they are sent again after the level
+func (server *Server) ResendSelections(w *packet.PacketWriter, id byte) {
+	if len(server.Clients[id].Selections) == 0 {
+		return
+	}
+
+	for selectionID, selection := range server.Clients[id].Selections {
+		writeSelection(w, selectionID, selection)
+	}
+
+	w.WriteToSocket(server.Clients[id].Socket)
+}
@@ -0,0 +1,499 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"goserver/blocks"
+	"goserver/compression"
+	"goserver/config"
+	"goserver/event"
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	CONFIG_FILE = "server.properties"
+	MAIN_LEVEL_FILE = "main.level"
+	WELCOME_FILE = "welcome.txt"
+
+	MAX_CLIENTS = 32
+	SAVE_INTERVAL = time.Minute * 5
+	ACCEPT_RETRY_DELAY = time.Second // Delay after a temporary error while accepting connections
+
+	// Used if the option is missing from the config
+	DEFAULT_SERVER_NAME = "Minecraft Server"
+	DEFAULT_MOTD = "Welcome to my Minecraft Server!"
+	DEFAULT_PORT = "25565"
+)
+
+// Options that have to be numbers if they are set
+var NUMBER_OPTIONS = []string{"port", "max-players"}
+
+var DEFAULT_CONFIG = "# Minecraft server properties (goserver)\nserver-name=" + DEFAULT_SERVER_NAME + "\nmotd=" + DEFAULT_MOTD + "\npublic=false\nport=" + DEFAULT_PORT + "\nverify-names=false\nmax-players=32\nmax-connections=1\ngrow-trees=false\nadmin-slot=false\nwebsocket=false\nheartbeat-url=\nverify-names-lan-bypass=false"
+
+var ErrServerClosed = errors.New("server is closed")
+
+// Everything is optional, the zero value runs a server like the goserver command does
+type Options struct {
+	Directory string // Directory of the level, config, rank, model and block definition files ("" for the working directory)
+	Config *config.Config // Server properties (nil to read server.properties, which is created if it doesn't exist)
+	Level *level.Level // Main level (nil to load the level file, which is generated if it doesn't exist)
+	LevelType int // Type of the level that is generated if there is no level file
+	Listener net.Listener // Listener for clients (nil to listen on the port from the config)
+	Logger *log.Logger // Logger for server messages (nil to log to stderr)
+}
+
+// The server state is owned by a single goroutine (run), which runs the tasks that the other goroutines submit with Do one at a time.
+// Connections, the ping thread, the save thread and the heartbeat only access the state from inside Do,
+// and code that runs inside Do must never call Do itself (it would wait for itself forever).
+// Sending to a client never blocks (see packet.QueuedConn), so tasks are always short.
+type Server struct {
+	Level level.Level // Main level
+	Clients []Client // Client slots (a slot is free if its socket is nil)
+	Config config.Config // server.properties (not changed after startup)
+	GlobalBlockDefinitions blocks.BlockDefinitions // Block definitions of every level
+	LevelBlockDefinitions blocks.BlockDefinitions // Block definitions of the main level
+	PlayerRanks config.Config // ranks.properties
+	PlayerModels config.Config // models.properties
+	Salt string // Salt that is sent to the heartbeat server (for verifying names)
+	Events event.Handlers // Event handlers
+
+	directory string // Directory of the server files
+	logger *log.Logger // Logger for server messages
+	listener net.Listener // Listener for clients
+
+	tasks chan func() // Tasks for the server goroutine
+	started bool // Whether Start has been called
+	stopping chan struct{} // Closed when the server starts shutting down
+	stopped chan struct{} // Closed when the server goroutine stops
+	stopOnce sync.Once
+	acceptDone chan struct{} // Closed when the accept thread stops
+	threads sync.WaitGroup // Save, ping and heartbeat threads
+	connections sync.WaitGroup // Connection goroutines
+	saving sync.Mutex // Held while the level is written to disk
+	fileWrites map[string][]byte // File -> snapshot that is waiting to be written (see QueueFileWrite)
+	fileWritesMutex sync.Mutex // Protects fileWrites
+	writingFiles sync.Mutex // Held while queued files are written to disk
+}
+
+// Creates a server and loads everything that isn't given in the options
+func New(options Options) (*Server, error) {
+	server := &Server{
+		Clients: make([]Client, MAX_CLIENTS),
+		directory: options.Directory,
+		logger: options.Logger,
+		listener: options.Listener,
+		tasks: make(chan func()),
+		stopping: make(chan struct{}),
+		stopped: make(chan struct{}),
+		acceptDone: make(chan struct{}),
+		fileWrites: make(map[string][]byte),
+	}
+
+	if server.logger == nil {
+		server.logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	var err error
+
+	if options.Config != nil {
+		server.Config = *options.Config
+	} else if server.Config, err = server.loadConfig(); err != nil {
+		return nil, err
+	}
+
+	if err = checkConfig(server.Config); err != nil {
+		return nil, errors.New("invalid config: " + err.Error())
+	}
+
+	// Names are verified with the salt that is sent with the heartbeat, so without a heartbeat no name can be verified
+	if server.Config.GetBooleanDefault("verify-names", false) && server.HeartbeatURL() == "" {
+		server.logger.Println("Warning: verify-names is enabled, but no heartbeat is sent (public=false and heartbeat-url is not set), so only players that bypass verification (verify-names-lan-bypass) can join.")
+	}
+
+	if options.Level != nil {
+		server.Level = *options.Level
+
+		if err = server.Level.Prepare(); err != nil {
+			return nil, errors.New("invalid level: " + err.Error())
+		}
+	} else if server.Level, err = server.loadLevel(options.LevelType); err != nil {
+		return nil, err
+	}
+
+	if err = server.LoadPlayerRanks(); err != nil {
+		return nil, err
+	}
+
+	if err = server.LoadPlayerModels(); err != nil {
+		return nil, err
+	}
+
+	if server.GlobalBlockDefinitions, err = server.LoadBlockDefinitions(GLOBAL_BLOCKS_FILE); err != nil {
+		return nil, err
+	}
+
+	if server.LevelBlockDefinitions, err = server.LoadBlockDefinitions(MAIN_LEVEL_BLOCKS_FILE); err != nil {
+		return nil, err
+	}
+
+	if server.Salt, err = GenerateSalt(); err != nil {
+		return nil, errors.New("failed to generate the salt: " + err.Error())
+	}
+
+	server.RegisterClickHandlers()
+
+	return server, nil
+}
+
+// Returns the path of a server file
+func (server *Server) Path(file string) string {
+	return filepath.Join(server.directory, file)
+}
+
+func (server *Server) loadConfig() (config.Config, error) {
+	path := server.Path(CONFIG_FILE)
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		server.logger.Println("Creating " + CONFIG_FILE + "...")
+
+		err := ioutil.WriteFile(path, []byte(DEFAULT_CONFIG), 0644)
+
+		if err != nil {
+			return config.Config{}, errors.New("failed to create " + CONFIG_FILE + ": " + err.Error())
+		}
+
+		return config.ParseConfig(DEFAULT_CONFIG)
+	}
+
+	server.logger.Println("Reading " + CONFIG_FILE + "...")
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return config.Config{}, err
+	}
+
+	serverConfig, err := config.ParseConfig(string(content))
+
+	if err != nil {
+		return config.Config{}, errors.New("failed to parse " + CONFIG_FILE + ": " + err.Error())
+	}
+
+	return serverConfig, nil
+}
+
+func checkConfig(serverConfig config.Config) error {
+	for _, key := range NUMBER_OPTIONS {
+		if !serverConfig.Exists(key) {
+			continue
+		}
+
+		if _, err := serverConfig.GetNumber(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (server *Server) loadLevel(levelType int) (level.Level, error) {
+	path := server.Path(MAIN_LEVEL_FILE)
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		server.logger.Println("Generating level...")
+		return level.GenerateLevel(128, 64, 128, level.LEVEL_EXPERIMENTAL, levelType, server.logger), nil
+	}
+
+	server.logger.Println("Loading level...")
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return level.Level{}, err
+	}
+
+	data, err := compression.DecompressData(content)
+
+	if err != nil {
+		return level.Level{}, errors.New("failed to decompress " + MAIN_LEVEL_FILE + ": " + err.Error())
+	}
+
+	mainLevel, err := level.DeserializeLevel(data, server.logger)
+
+	if err != nil {
+		return level.Level{}, errors.New("failed to load " + MAIN_LEVEL_FILE + ": " + err.Error())
+	}
+
+	return mainLevel, nil
+}
+
+// Starts listening for clients and starts the server threads (the context is only used while starting)
+func (server *Server) Start(ctx context.Context) error {
+	if server.started {
+		return errors.New("server has already been started")
+	}
+
+	if server.listener == nil {
+		var listenConfig net.ListenConfig
+		listener, err := listenConfig.Listen(ctx, "tcp", "127.0.0.1:"+server.Config.GetStringDefault("port", DEFAULT_PORT))
+
+		if err != nil {
+			return err
+		}
+
+		server.listener = listener
+	}
+
+	server.started = true
+
+	go server.run()
+
+	server.logger.Println("Starting level save thread...")
+	server.startThread(server.LevelSaveThread)
+
+	server.logger.Println("Starting ping thread...")
+	server.startThread(server.PingThread)
+
+	if heartbeatURL := server.HeartbeatURL(); len(heartbeatURL) != 0 {
+		server.logger.Println("Starting heartbeat thread...")
+		server.startThread(func() {
+			server.HeartbeatThread(heartbeatURL)
+		})
+	}
+
+	server.logger.Println("Listening for clients...")
+
+	go server.AcceptThread()
+
+	return nil
+}
+
+// Returns the address that the server is listening on (nil if the server hasn't been started)
+func (server *Server) Addr() net.Addr {
+	if server.listener == nil {
+		return nil
+	}
+
+	return server.listener.Addr()
+}
+
+// Stops accepting clients, disconnects every client and saves the level.
+// The level is saved even if the context expires first, but the connections and threads that are still running are not waited for.
+func (server *Server) Shutdown(ctx context.Context) error {
+	if !server.started {
+		return nil
+	}
+
+	err := ErrServerClosed
+
+	server.stopOnce.Do(func() {
+		err = server.shutdown(ctx)
+	})
+
+	return err
+}
+
+func (server *Server) shutdown(ctx context.Context) error {
+	close(server.stopping)
+	server.listener.Close()
+	<-server.acceptDone
+
+	server.Do(func() {
+		w := packet.CreatePacketWriter()
+
+		for i := 0; i < len(server.Clients); i++ {
+			if server.Clients[i].Socket == nil {
+				continue
+			}
+
+			protocol.WriteDisconnect(&w, protocol.DISCONNECT_SHUTDOWN)
+			w.WriteToSocket(server.Clients[i].Socket)
+			server.Clients[i].Socket.Close()
+		}
+	})
+
+	done := make(chan struct{})
+
+	go func() {
+		server.connections.Wait()
+		server.threads.Wait()
+		close(done)
+	}()
+
+	var err error
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	server.SaveLevel()
+	close(server.stopped)
+
+	return err
+}
+
+// Runs the tasks that are submitted with Do (this is the only goroutine that accesses the server state)
+func (server *Server) run() {
+	for {
+		select {
+		case task := <-server.tasks:
+			task()
+		case <-server.stopped:
+			return
+		}
+	}
+}
+
+// Runs the task on the server goroutine and waits until it is done.
+// Returns false without running the task if the server has stopped.
+func (server *Server) Do(task func()) bool {
+	done := make(chan struct{})
+
+	select {
+	case server.tasks <- func() {
+		task()
+		close(done)
+	}:
+	case <-server.stopped:
+		return false
+	}
+
+	<-done
+	return true
+}
+
+func (server *Server) startThread(thread func()) {
+	server.threads.Add(1)
+
+	go func() {
+		defer server.threads.Done()
+		thread()
+	}()
+}
+
+// Waits for the duration, and returns false if the server started shutting down in the meantime
+func (server *Server) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-server.stopping:
+		return false
+	}
+}
+
+func (server *Server) AcceptThread() {
+	defer close(server.acceptDone)
+
+	for {
+		conn, err := server.listener.Accept()
+
+		if err != nil {
+			select {
+			case <-server.stopping:
+				return
+			default:
+			}
+
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				server.logger.Println("Failed to accept a connection:", err)
+				server.sleep(ACCEPT_RETRY_DELAY)
+				continue
+			}
+
+			server.logger.Println("Stopped accepting connections:", err)
+			return
+		}
+
+		server.logger.Println("Accepted Connection:", conn.RemoteAddr())
+
+		server.connections.Add(1)
+
+		go func() {
+			defer server.connections.Done()
+			server.HandleConnection(conn)
+		}()
+	}
+}
+
+// Saves a snapshot of the level and the block definitions (this must not be called from the server goroutine)
+func (server *Server) SaveLevel() {
+	server.saving.Lock()
+	defer server.saving.Unlock()
+
+	server.logger.Println("Saving level...")
+
+	var levelData []byte
+
+	if !server.Do(func() {
+		levelData = server.Level.Serialize()
+		server.queueBlockDefinitions()
+	}) {
+		return
+	}
+
+	err := ioutil.WriteFile(server.Path(MAIN_LEVEL_FILE), compression.CompressData(levelData), 0644)
+
+	if err != nil {
+		server.logger.Println("Failed to save level:", err)
+	} else {
+		server.logger.Println("Level saved!")
+	}
+
+	server.WriteQueuedFiles()
+}
+
+// Queues a snapshot of a server file to be written by WriteQueuedFiles (this must be called from the server goroutine).
+// Files are written outside of the server goroutine, so that clients don't wait for the disk.
+func (server *Server) QueueFileWrite(file string, data []byte) {
+	server.fileWritesMutex.Lock()
+	defer server.fileWritesMutex.Unlock()
+
+	server.fileWrites[file] = data
+}
+
+// Writes the queued snapshots to disk (this must not be called from the server goroutine).
+// Only one call writes at a time, so a file is never overwritten with an older snapshot.
+func (server *Server) WriteQueuedFiles() {
+	server.writingFiles.Lock()
+	defer server.writingFiles.Unlock()
+
+	server.fileWritesMutex.Lock()
+	files := server.fileWrites
+	server.fileWrites = make(map[string][]byte)
+	server.fileWritesMutex.Unlock()
+
+	for file, data := range files {
+		if err := ioutil.WriteFile(server.Path(file), data, 0644); err != nil {
+			server.logger.Println("Failed to save "+file+":", err)
+		}
+	}
+}
+
+// Writes the queued snapshots in the background (for code that runs on the server goroutine)
+func (server *Server) writeQueuedFilesLater() {
+	server.startThread(server.WriteQueuedFiles)
+}
+
+func (server *Server) LevelSaveThread() {
+	for {
+		server.SaveLevel()
+
+		if !server.sleep(SAVE_INTERVAL) {
+			return
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"goserver/config"
+	"goserver/level"
+	"goserver/packet"
+	"goserver/protocol"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testConfig(data map[string]string) config.Config {
+	properties := map[string]string{
+		"server-name": "Test Server",
+		"motd": "Test",
+		"port": "25565",
+		"public": "false",
+		"verify-names": "false",
+		"max-players": "8",
+		"max-connections": "2",
+	}
+
+	for key, value := range data {
+		properties[key] = value
+	}
+
+	return config.Config{Data: properties}
+}
+
+// Creates a server in a temporary directory that listens on a random local port
+func createTestServer(t *testing.T, properties map[string]string) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := testConfig(properties)
+	testLevel := level.GenerateLevel(16, 16, 16, level.LEVEL_FLAT, level.LEVEL_TYPE_NORMAL, nil)
+
+	server, err := New(Options{
+		Directory: t.TempDir(),
+		Config: &serverConfig,
+		Level: &testLevel,
+		Listener: listener,
+		Logger: log.New(ioutil.Discard, "", 0),
+	})
+
+	if err != nil {
+		listener.Close()
+		t.Fatal(err)
+	}
+
+	return server
+}
+
+// Reads the packets that a client without CPE gets while joining, up to the end of the level
+func readJoin(t *testing.T, conn net.Conn) {
+	identification := make([]byte, 131)
+
+	if _, err := io.ReadFull(conn, identification); err != nil {
+		t.Fatal("failed to read the server identification:", err)
+	}
+
+	if identification[0] != protocol.SERVER_IDENTIFICATION || identification[1] != protocol.PROTOCOL_VERSION || !bytes.HasPrefix(identification[2:], []byte("Test Server ")) {
+		t.Fatalf("unexpected server identification %q", identification)
+	}
+
+	packetID := make([]byte, 1)
+
+	if _, err := io.ReadFull(conn, packetID); err != nil || packetID[0] != protocol.SERVER_LEVEL_INITIALIZE {
+		t.Fatalf("expected Level Initialize, got %x (%v)", packetID, err)
+	}
+
+	for {
+		if _, err := io.ReadFull(conn, packetID); err != nil {
+			t.Fatal(err)
+		}
+
+		if packetID[0] == protocol.SERVER_LEVEL_FINALIZE {
+			break
+		}
+
+		if packetID[0] != protocol.SERVER_LEVEL_DATA_CHUNK {
+			t.Fatalf("unexpected packet %#x while reading the level", packetID[0])
+		}
+
+		if _, err := io.ReadFull(conn, make([]byte, 1027)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Level size
+	if _, err := io.ReadFull(conn, make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Connects a client without CPE and reads everything up to the end of the level
+func joinTestClient(t *testing.T, server *Server, username string) net.Conn {
+	conn, err := net.Dial("tcp", server.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(time.Second * 10))
+
+	w := packet.CreatePacketWriter()
+	w.WriteByte(protocol.CLIENT_IDENTIFICATION)
+	w.WriteByte(protocol.PROTOCOL_VERSION)
+	w.WriteString(username)
+	w.WriteString("-")
+	w.WriteByte(0x00)
+	w.WriteToSocket(conn)
+
+	readJoin(t, conn)
+
+	return conn
+}
+
+func TestServerLifecycle(t *testing.T) {
+	server := createTestServer(t, nil)
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := joinTestClient(t, server, "tester")
+	defer conn.Close()
+
+	joined := 0
+	username := ""
+
+	server.Do(func() {
+		joined = server.JoinedClientCount()
+		username = server.Clients[0].Username
+	})
+
+	if joined != 1 || username != "tester" {
+		t.Fatalf("%d joined clients, first client %q; want tester", joined, username)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second * 10)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client is disconnected with the shutdown message, after whatever else was still queued
+	rest, _ := ioutil.ReadAll(conn)
+
+	if !bytes.Contains(rest, append([]byte{protocol.SERVER_DISCONNECT}, protocol.DISCONNECT_SHUTDOWN...)) {
+		t.Fatalf("the client didn't get the shutdown message: %q", rest)
+	}
+
+	if _, err := os.Stat(server.Path(MAIN_LEVEL_FILE)); err != nil {
+		t.Fatal("the level wasn't saved:", err)
+	}
+
+	if server.Do(func() {}) {
+		t.Fatal("the server still runs tasks after shutting down")
+	}
+
+	if err := server.Shutdown(ctx); err != ErrServerClosed {
+		t.Fatalf("second Shutdown: %v; want ErrServerClosed", err)
+	}
+}
+
+func TestMaxPlayers(t *testing.T) {
+	server := createTestServer(t, map[string]string{"max-players": "1"})
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Shutdown(context.Background())
+
+	conn := joinTestClient(t, server, "first")
+	defer conn.Close()
+
+	second, err := net.Dial("tcp", server.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer second.Close()
+	second.SetDeadline(time.Now().Add(time.Second * 10))
+
+	w := packet.CreatePacketWriter()
+	w.WriteByte(protocol.CLIENT_IDENTIFICATION)
+	w.WriteByte(protocol.PROTOCOL_VERSION)
+	w.WriteString("second")
+	w.WriteString("-")
+	w.WriteByte(0x00)
+	w.WriteToSocket(second)
+
+	// The second player is disconnected, because the only slot is taken
+	rest, _ := ioutil.ReadAll(second)
+
+	if !bytes.HasPrefix(rest, []byte{protocol.SERVER_DISCONNECT}) || !bytes.Contains(rest, []byte(protocol.DISCONNECT_SERVER_FULL)) {
+		t.Fatalf("the second player got %q; want the server full message", rest)
+	}
+
+	maxPlayers := ""
+
+	server.Do(func() {
+		maxPlayers = server.HeartbeatParameters().Get("max")
+	})
+
+	if maxPlayers != "1" {
+		t.Fatalf("heartbeat max = %q; want 1", maxPlayers)
+	}
+}
+
+func TestSavedLevelLoads(t *testing.T) {
+	server := createTestServer(t, nil)
+	server.Level.SetBlock(1, 10, 2, 1)
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	serverConfig := testConfig(nil)
+	loaded, err := New(Options{Directory: server.directory, Config: &serverConfig, Logger: log.New(ioutil.Discard, "", 0)})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Level.GetBlock(1, 10, 2) != 1 {
+		t.Fatal("the saved level doesn't contain the changed block")
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	discard := log.New(ioutil.Discard, "", 0)
+
+	// Invalid options are reported instead of exiting
+	invalidConfig := testConfig(map[string]string{"max-players": "many"})
+
+	if _, err := New(Options{Directory: t.TempDir(), Config: &invalidConfig, Logger: discard}); err == nil {
+		t.Error("New accepted an invalid number option")
+	}
+
+	directory := t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(directory, CONFIG_FILE), []byte("server-name=Test\nport\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Options{Directory: directory, Logger: discard}); err == nil {
+		t.Error("New accepted a config line without \"=\"")
+	}
+
+	// A broken level file is reported instead of panicking
+	serverConfig := testConfig(nil)
+	directory = t.TempDir()
+
+	if err := ioutil.WriteFile(filepath.Join(directory, MAIN_LEVEL_FILE), []byte("not a level"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New(Options{Directory: directory, Config: &serverConfig, Logger: discard}); err == nil {
+		t.Error("New accepted a broken level file")
+	}
+}
+
+func TestEmbedderLevel(t *testing.T) {
+	// A level built by hand has no block array, permissions or cache
+	serverConfig := testConfig(nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server, err := New(Options{
+		Directory: t.TempDir(),
+		Config: &serverConfig,
+		Level: &level.Level{Width: 16, Height: 16, Depth: 16},
+		Listener: listener,
+		Logger: log.New(ioutil.Discard, "", 0),
+	})
+
+	if err != nil {
+		listener.Close()
+		t.Fatal(err)
+	}
+
+	if err := server.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Shutdown(context.Background())
+
+	conn := joinTestClient(t, server, "tester")
+	defer conn.Close()
+
+	w := packet.CreatePacketWriter()
+	w.WriteByte(protocol.CLIENT_SET_BLOCK)
+	w.WriteShort(1)
+	w.WriteShort(1)
+	w.WriteShort(1)
+	w.WriteByte(0x01)
+	w.WriteByte(1)
+	w.WriteToSocket(conn)
+
+	placed := false
+
+	for i := 0; i < 100 && !placed; i++ {
+		time.Sleep(time.Millisecond * 20)
+
+		server.Do(func() {
+			placed = server.Level.GetBlock(1, 1, 1) == 1
+		})
+	}
+
+	if !placed {
+		t.Fatal("the block wasn't placed")
+	}
+
+	server.Do(func() {
+		server.Level.DeflateConverted(server.BlockConversionTable(server.Clients[0]))
+		server.Level.Permissions.DeniedPlace[1] = true
+	})
+}
+
+func TestEmbedderLevelInvalid(t *testing.T) {
+	serverConfig := testConfig(nil)
+	invalidLevel := level.Level{Width: 16, Height: 16, Depth: 16, Data: make([]byte, 10)}
+
+	if _, err := New(Options{Directory: t.TempDir(), Config: &serverConfig, Level: &invalidLevel, Logger: log.New(ioutil.Discard, "", 0)}); err == nil {
+		t.Fatal("New accepted a block array that doesn't match the level size")
+	}
+}
+
+func TestQueuedFileWrites(t *testing.T) {
+	server := createTestServer(t, nil)
+
+	// Only the newest snapshot of a file is written
+	server.QueueFileWrite(MODELS_FILE, []byte("alice.model=chicken\n"))
+	server.QueueFileWrite(MODELS_FILE, []byte("alice.model=pig\n"))
+	server.WriteQueuedFiles()
+
+	content, err := ioutil.ReadFile(server.Path(MODELS_FILE))
+
+	if err != nil || string(content) != "alice.model=pig\n" {
+		t.Fatalf("%s = %q, %v", MODELS_FILE, content, err)
+	}
+
+	// Nothing is written again until something is queued
+	os.Remove(server.Path(MODELS_FILE))
+	server.WriteQueuedFiles()
+
+	if _, err := os.Stat(server.Path(MODELS_FILE)); err == nil {
+		t.Fatal("an already written snapshot was written again")
+	}
+
+	// Saving from the server goroutine writes in the background
+	server.PlayerModels.Data["bob.model"] = "sit"
+	server.SavePlayerModels()
+	server.threads.Wait()
+
+	content, err = ioutil.ReadFile(server.Path(MODELS_FILE))
+
+	if err != nil || string(content) != "bob.model=sit\n" {
+		t.Fatalf("%s = %q, %v", MODELS_FILE, content, err)
+	}
+}
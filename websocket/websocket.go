@@ -0,0 +1,298 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// WebSocket (RFC 6455) connections for browser clients.
+// The ClassiCube web client sends the Classic protocol in binary frames.
+
+const (
+	OPCODE_CONTINUATION = 0x0
+	OPCODE_TEXT = 0x1
+	OPCODE_BINARY = 0x2
+	OPCODE_CLOSE = 0x8
+	OPCODE_PING = 0x9
+	OPCODE_PONG = 0xa
+
+	ACCEPT_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	MAX_FRAME_SIZE = 1 << 20
+	MAX_CONTROL_FRAME_SIZE = 125
+	MAX_HANDSHAKE_SIZE = 4096 // The upgrade request has to fit into the buffer of the reader
+	SUBPROTOCOL = "ClassiCube"
+)
+
+var ErrInvalidHandshake = errors.New("invalid websocket handshake")
+var ErrInvalidFrame = errors.New("invalid websocket frame")
+var ErrHandshakeTooLarge = errors.New("websocket handshake is too large")
+
+// Conn wraps a connection so that reads return the payload of the frames sent by the client, and every write is sent as one binary frame
+type Conn struct {
+	net.Conn
+	reader *bufio.Reader
+	writeMutex sync.Mutex
+	remaining uint64 // Payload bytes of the current frame that have not been read yet
+	mask [4]byte
+	maskIndex int
+}
+
+// A connection that has been peeked at, reads start with the peeked bytes
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// Returns a WebSocket connection if the client starts with an HTTP request, and the connection itself otherwise.
+// Classic clients start with the identification packet (packet ID 0x00), so the first byte tells them apart.
+func Sniff(conn net.Conn) (net.Conn, error) {
+	reader := bufio.NewReaderSize(conn, MAX_HANDSHAKE_SIZE)
+	first, err := reader.Peek(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] != 'G' {
+		return &bufferedConn{conn, reader}, nil
+	}
+
+	wrapped, err := Upgrade(conn, reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return wrapped, nil
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + ACCEPT_GUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func headerContains(header http.Header, name string, value string) bool {
+	for _, item := range strings.Split(header.Get(name), ",") {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Waits until the whole request header is buffered, so that requests larger than the buffer are rejected before they are parsed
+func bufferHeader(reader *bufio.Reader) error {
+	for {
+		buffered, _ := reader.Peek(reader.Buffered())
+
+		if bytes.Contains(buffered, []byte("\r\n\r\n")) {
+			return nil
+		}
+
+		// Peeking past the buffered bytes reads more from the connection
+		if _, err := reader.Peek(len(buffered) + 1); err == bufio.ErrBufferFull {
+			return ErrHandshakeTooLarge
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Reads the HTTP upgrade request and answers it (the request can't be larger than the buffer of the reader)
+func Upgrade(conn net.Conn, reader *bufio.Reader) (*Conn, error) {
+	if err := bufferHeader(reader); err != nil {
+		return nil, err
+	}
+
+	request, err := http.ReadRequest(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	key := request.Header.Get("Sec-WebSocket-Key")
+
+	if request.Method != "GET" || !headerContains(request.Header, "Upgrade", "websocket") || !headerContains(request.Header, "Connection", "Upgrade") || request.Header.Get("Sec-WebSocket-Version") != "13" || len(key) == 0 {
+		io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\nConnection: close\r\n\r\n")
+		return nil, ErrInvalidHandshake
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n"
+	response += "Upgrade: websocket\r\n"
+	response += "Connection: Upgrade\r\n"
+	response += "Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+
+	if headerContains(request.Header, "Sec-WebSocket-Protocol", SUBPROTOCOL) {
+		response += "Sec-WebSocket-Protocol: " + SUBPROTOCOL + "\r\n"
+	}
+
+	response += "\r\n"
+
+	if _, err := io.WriteString(conn, response); err != nil {
+		return nil, err
+	}
+
+	return &Conn{Conn: conn, reader: reader}, nil
+}
+
+// Reads a frame header, and returns the opcode and payload length
+func (c *Conn) readHeader() (byte, uint64, error) {
+	header := make([]byte, 2)
+
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return 0, 0, err
+	}
+
+	final := header[0] & 0x80 != 0
+	reserved := header[0] & 0x70
+	opcode := header[0] & 0x0f
+	masked := header[1] & 0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	// No extensions are negotiated, so the reserved bits must be 0
+	if reserved != 0 {
+		return 0, 0, ErrInvalidFrame
+	}
+
+	// Control frames can't be fragmented, and their payload must fit into the first length byte
+	if opcode & 0x08 != 0 && (!final || length > MAX_CONTROL_FRAME_SIZE) {
+		return 0, 0, ErrInvalidFrame
+	}
+
+	if length == 126 {
+		extended := make([]byte, 2)
+
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return 0, 0, err
+		}
+
+		length = uint64(binary.BigEndian.Uint16(extended))
+	} else if length == 127 {
+		extended := make([]byte, 8)
+
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return 0, 0, err
+		}
+
+		length = binary.BigEndian.Uint64(extended)
+	}
+
+	// Clients must mask their frames
+	if !masked || length > MAX_FRAME_SIZE {
+		return 0, 0, ErrInvalidFrame
+	}
+
+	if _, err := io.ReadFull(c.reader, c.mask[:]); err != nil {
+		return 0, 0, err
+	}
+
+	c.maskIndex = 0
+
+	return opcode, length, nil
+}
+
+func (c *Conn) readPayload(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+
+	for i := 0; i < n; i++ {
+		p[i] ^= c.mask[c.maskIndex % 4]
+		c.maskIndex++
+	}
+
+	c.remaining -= uint64(n)
+
+	return n, err
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		opcode, length, err := c.readHeader()
+
+		if err != nil {
+			return 0, err
+		}
+
+		c.remaining = length
+
+		switch opcode {
+		case OPCODE_CONTINUATION, OPCODE_TEXT, OPCODE_BINARY:
+			continue
+		case OPCODE_PING, OPCODE_PONG, OPCODE_CLOSE:
+			payload := make([]byte, length)
+
+			for read := 0; read < len(payload); {
+				n, err := c.readPayload(payload[read:])
+
+				if err != nil {
+					return 0, err
+				}
+
+				read += n
+			}
+
+			if opcode == OPCODE_PING {
+				c.writeFrame(OPCODE_PONG, payload)
+			}
+
+			if opcode == OPCODE_CLOSE {
+				c.writeFrame(OPCODE_CLOSE, nil)
+				return 0, io.EOF
+			}
+		default:
+			return 0, ErrInvalidFrame
+		}
+	}
+
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+
+	return c.readPayload(p)
+}
+
+// Server frames are not masked
+func (c *Conn) writeFrame(opcode byte, payload []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	header := []byte{0x80 | opcode}
+	length := len(payload)
+
+	if length < 126 {
+		header = append(header, byte(length))
+	} else if length <= 0xffff {
+		header = append(header, 126, byte(length >> 8), byte(length))
+	} else {
+		extended := make([]byte, 8)
+		binary.BigEndian.PutUint64(extended, uint64(length))
+		header = append(append(header, 127), extended...)
+	}
+
+	if _, err := c.Conn.Write(append(header, payload...)); err != nil {
+		return 0, err
+	}
+
+	return length, nil
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	return c.writeFrame(OPCODE_BINARY, p)
+}
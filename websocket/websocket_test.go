@@ -0,0 +1,265 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// A connection that reads from a fixed stream and records what is written
+type testConn struct {
+	net.Conn
+	input io.Reader
+	written bytes.Buffer
+}
+
+func (c *testConn) Read(p []byte) (int, error) {
+	return c.input.Read(p)
+}
+
+func (c *testConn) Write(p []byte) (int, error) {
+	return c.written.Write(p)
+}
+
+var testMask = [4]byte{0x12, 0x34, 0x56, 0x78}
+
+// Builds a masked client frame
+func clientFrame(final bool, opcode byte, payload []byte) []byte {
+	first := opcode
+
+	if final {
+		first |= 0x80
+	}
+
+	frame := []byte{first}
+	length := len(payload)
+
+	if length < 126 {
+		frame = append(frame, 0x80 | byte(length))
+	} else if length <= 0xffff {
+		frame = append(frame, 0x80 | 126, byte(length >> 8), byte(length))
+	} else {
+		extended := make([]byte, 8)
+		binary.BigEndian.PutUint64(extended, uint64(length))
+		frame = append(append(frame, 0x80 | 127), extended...)
+	}
+
+	frame = append(frame, testMask[:]...)
+
+	for i, b := range payload {
+		frame = append(frame, b ^ testMask[i % 4])
+	}
+
+	return frame
+}
+
+func testPayload(length int) []byte {
+	payload := make([]byte, length)
+
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+
+	return payload
+}
+
+func createTestConn(frames ...[]byte) (*Conn, *testConn) {
+	raw := &testConn{input: bytes.NewReader(bytes.Join(frames, nil))}
+	return &Conn{Conn: raw, reader: bufio.NewReader(raw)}, raw
+}
+
+func TestUpgrade(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"
+	request += "Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Protocol: ClassiCube\r\n\r\n"
+
+	raw := &testConn{input: io.MultiReader(strings.NewReader(request), bytes.NewReader(clientFrame(true, OPCODE_BINARY, []byte{0x00, 0x07})))}
+	conn, err := Sniff(raw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The accept key from the example in RFC 6455
+	response := raw.written.String()
+
+	if !strings.HasPrefix(response, "HTTP/1.1 101 ") || !strings.Contains(response, "Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n") || !strings.Contains(response, "Sec-WebSocket-Protocol: ClassiCube\r\n") {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	data, err := ioutil.ReadAll(conn)
+
+	if err != nil || !bytes.Equal(data, []byte{0x00, 0x07}) {
+		t.Fatalf("data = %x, %v; want 0007", data, err)
+	}
+}
+
+func TestUpgradeSplit(t *testing.T) {
+	// The request arrives one byte at a time, so the header has to be buffered over several reads
+	request := "GET / HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	raw := &testConn{input: iotest.OneByteReader(strings.NewReader(request))}
+
+	if _, err := Sniff(raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(raw.written.String(), "HTTP/1.1 101 ") {
+		t.Fatalf("unexpected response %q", raw.written.String())
+	}
+}
+
+func TestSniffClassic(t *testing.T) {
+	raw := &testConn{input: bytes.NewReader([]byte{0x00, 0x07, 'a'})}
+	conn, err := Sniff(raw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadAll(conn)
+
+	if err != nil || !bytes.Equal(data, []byte{0x00, 0x07, 'a'}) {
+		t.Fatalf("data = %x, %v; want the unchanged stream", data, err)
+	}
+}
+
+func TestUpgradeTooLarge(t *testing.T) {
+	request := "GET / HTTP/1.1\r\nHost: localhost\r\nX-Padding: " + strings.Repeat("a", MAX_HANDSHAKE_SIZE) + "\r\n\r\n"
+	raw := &testConn{input: strings.NewReader(request)}
+
+	if _, err := Sniff(raw); err != ErrHandshakeTooLarge {
+		t.Fatalf("err = %v; want ErrHandshakeTooLarge", err)
+	}
+}
+
+func TestUpgradeInvalid(t *testing.T) {
+	raw := &testConn{input: strings.NewReader("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")}
+
+	if _, err := Sniff(raw); err != ErrInvalidHandshake {
+		t.Fatalf("err = %v; want ErrInvalidHandshake", err)
+	}
+
+	if !strings.HasPrefix(raw.written.String(), "HTTP/1.1 400 ") {
+		t.Fatalf("unexpected response %q", raw.written.String())
+	}
+}
+
+func TestReadMasked(t *testing.T) {
+	payload := []byte("Hello, world!")
+	conn, _ := createTestConn(clientFrame(true, OPCODE_BINARY, payload))
+	data, err := ioutil.ReadAll(conn)
+
+	if err != nil || !bytes.Equal(data, payload) {
+		t.Fatalf("data = %q, %v; want %q", data, err, payload)
+	}
+}
+
+func TestReadExtendedLengths(t *testing.T) {
+	for _, length := range []int{125, 126, 0xffff, 0x10000, 70000} {
+		payload := testPayload(length)
+		conn, _ := createTestConn(clientFrame(true, OPCODE_BINARY, payload))
+		data, err := ioutil.ReadAll(conn)
+
+		if err != nil || !bytes.Equal(data, payload) {
+			t.Fatalf("length %d: read %d bytes, %v", length, len(data), err)
+		}
+	}
+}
+
+func TestReadFragmented(t *testing.T) {
+	conn, _ := createTestConn(clientFrame(false, OPCODE_BINARY, []byte("abc")), clientFrame(true, OPCODE_CONTINUATION, []byte("def")))
+	data, err := ioutil.ReadAll(conn)
+
+	if err != nil || string(data) != "abcdef" {
+		t.Fatalf("data = %q, %v; want abcdef", data, err)
+	}
+}
+
+func TestReadUnmasked(t *testing.T) {
+	conn, _ := createTestConn([]byte{0x80 | OPCODE_BINARY, 0x01, 0x00})
+
+	if _, err := conn.Read(make([]byte, 16)); err != ErrInvalidFrame {
+		t.Fatalf("err = %v; want ErrInvalidFrame", err)
+	}
+}
+
+func TestReadTooLarge(t *testing.T) {
+	header := []byte{0x80 | OPCODE_BINARY, 0x80 | 127, 0, 0, 0, 0, 0, 0x20, 0, 0}
+	conn, _ := createTestConn(header, testMask[:])
+
+	if _, err := conn.Read(make([]byte, 16)); err != ErrInvalidFrame {
+		t.Fatalf("err = %v; want ErrInvalidFrame", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	conn, raw := createTestConn(clientFrame(true, OPCODE_PING, []byte("ping")), clientFrame(true, OPCODE_BINARY, []byte{0x01}))
+	data := make([]byte, 16)
+	n, err := conn.Read(data)
+
+	if err != nil || !bytes.Equal(data[:n], []byte{0x01}) {
+		t.Fatalf("data = %x, %v; want 01", data[:n], err)
+	}
+
+	pong := append([]byte{0x80 | OPCODE_PONG, 4}, "ping"...)
+
+	if !bytes.Equal(raw.written.Bytes(), pong) {
+		t.Fatalf("written = %x; want %x", raw.written.Bytes(), pong)
+	}
+}
+
+func TestClose(t *testing.T) {
+	conn, raw := createTestConn(clientFrame(true, OPCODE_CLOSE, []byte{0x03, 0xe8}))
+
+	if _, err := conn.Read(make([]byte, 16)); err != io.EOF {
+		t.Fatalf("err = %v; want EOF", err)
+	}
+
+	if !bytes.Equal(raw.written.Bytes(), []byte{0x80 | OPCODE_CLOSE, 0}) {
+		t.Fatalf("written = %x; want a close frame", raw.written.Bytes())
+	}
+}
+
+func TestInvalidControlFrames(t *testing.T) {
+	frames := map[string][]byte{
+		"fragmented ping": clientFrame(false, OPCODE_PING, []byte("ping")),
+		"long ping": clientFrame(true, OPCODE_PING, testPayload(126)),
+		"fragmented close": clientFrame(false, OPCODE_CLOSE, nil),
+		"reserved bits": append([]byte{0xc0 | OPCODE_BINARY}, clientFrame(true, OPCODE_BINARY, []byte{0x01})[1:]...),
+		"unknown opcode": clientFrame(true, 0x3, []byte{0x01}),
+	}
+
+	for name, frame := range frames {
+		conn, raw := createTestConn(frame)
+
+		if _, err := conn.Read(make([]byte, 256)); err != ErrInvalidFrame {
+			t.Errorf("%s: err = %v; want ErrInvalidFrame", name, err)
+		}
+
+		if raw.written.Len() != 0 {
+			t.Errorf("%s: unexpected reply %x", name, raw.written.Bytes())
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, length := range []int{1, 125, 126, 0xffff, 0x10000} {
+		conn, raw := createTestConn()
+		payload := testPayload(length)
+
+		if n, err := conn.Write(payload); n != length || err != nil {
+			t.Fatalf("length %d: Write = %d, %v", length, n, err)
+		}
+
+		written := raw.written.Bytes()
+
+		if written[0] != 0x80 | OPCODE_BINARY || written[1] & 0x80 != 0 || !bytes.Equal(written[len(written) - length:], payload) {
+			t.Fatalf("length %d: unexpected frame header %x", length, written[:2])
+		}
+	}
+}